@@ -6,6 +6,7 @@ package database
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"io"
 	"runtime/debug"
 
@@ -60,34 +61,97 @@ func NewDB(drvName string, db *sql.DB) *DB {
 func Open(drvName, dsn string) (*DB, error) {
 	db, err := sql.Open(drvName, dsn)
 	if err != nil {
-		return nil, errors.As(err, drvName, dsn)
+		return nil, errors.As(err, drvName, redactDSN(drvName, dsn))
 	}
 	return newDB(drvName, db), nil
 }
 
+// Return the dsn with the password masked by the format of driver,
+// all of it will be masked if the dsn can not be parsed.
+func RedactDSN(drvName, dsn string) string {
+	return redactDSN(drvName, dsn)
+}
+
+// Mark the query arg as sensitive, it is passed to the driver as it is,
+// but masked in the errors annotated by this package.
+func Sensitive(arg interface{}) driver.Valuer {
+	return sensitiveArg{arg: arg}
+}
+
+// Return the args for annotating the errors or logs, the Sensitive args are masked,
+// and the others are redacted or truncated by the ARGS_MODE.
+func RedactArgs(args ...interface{}) []interface{} {
+	return redactArgs(args)
+}
+
 // Register a db to the connection pool by manully.
 func RegCache(iniFileName, sectionName string, db *DB) {
-	regCache(iniFileName, sectionName, db)
+	defaultRegistry.Register(CacheKey{Source: iniFileName, Section: sectionName}, db)
 }
 
 // Get the db instance from the cache.
 // If the db not in the cache, it will create a new instance from the ini file.
 func GetCache(iniFileName, sectionName string) *DB {
-	db, err := getCache(iniFileName, sectionName)
+	db, err := defaultRegistry.Get(NewIniLoader(iniFileName), sectionName)
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+// Get the db instance from the cache.
+// If the db not in the cache, it will create a new instance from the config loader,
+// the builtin loaders are NewIniLoader, NewJSONLoader, NewYAMLLoader, NewTOMLLoader and NewEnvLoader.
+func GetCacheFrom(loader ConfigLoader, sectionName string) *DB {
+	db, err := defaultRegistry.Get(loader, sectionName)
 	if err != nil {
 		panic(err)
 	}
 	return db
 }
 
+// Checking the cache does it have a db instance from the config loader.
+func HasCacheFrom(loader ConfigLoader, sectionName string) (*DB, error) {
+	return defaultRegistry.Get(loader, sectionName)
+}
+
 // Checking the cache does it have a db instance.
 func HasCache(etcFileName, sectionName string) (*DB, error) {
-	return getCache(etcFileName, sectionName)
+	return defaultRegistry.Get(NewIniLoader(etcFileName), sectionName)
+}
+
+// Get the read/write splitting cluster of the section from the cache,
+// the replicas are the sections listed by the 'replicas' key of the section.
+// It will panic if the section or its replicas can not be opened.
+func GetCluster(iniFileName, sectionName string) *Cluster {
+	c, err := defaultRegistry.NewCluster(NewIniLoader(iniFileName), sectionName)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Make a read/write splitting cluster of the section from the config loader.
+func NewCluster(loader ConfigLoader, sectionName string) (*Cluster, error) {
+	return defaultRegistry.NewCluster(loader, sectionName)
+}
+
+// Get the db instance from the cache, or open a new one and ping it with ctx.
+// It returns the error instead of panic.
+func GetCacheContext(ctx context.Context, iniFileName, sectionName string) (*DB, error) {
+	return defaultRegistry.GetContext(ctx, NewIniLoader(iniFileName), sectionName)
 }
 
 // Close all instance in the cache.
 func CloseCache() {
-	closeCache()
+	defaultRegistry.Close()
+}
+
+// Close all instance in the cache gracefully, the cache lookup is failed with ErrCacheClosing until it returns.
+// It waits the in-use connections returned until ctx is done, and then closes the dbs,
+// the errors of closing are returned by a *CloseCacheError.
+func CloseCacheContext(ctx context.Context) error {
+	return defaultRegistry.CloseContext(ctx)
 }
 
 // A lazy function to closed the io.Closer
@@ -111,23 +175,43 @@ func Rollback(tx *sql.Tx) {
 	}
 }
 
+// Convert the '?' bind variables of query to the bind style of driver,
+// such as '$1' for postgres, ':1' for oracle, '@p1' for sqlserver.
+// The '?' in string literals, quoted identifiers and comments are kept.
+func Rebind(drvName, query string) string {
+	return rebind(GetDialect(drvName), query)
+}
+
 // A way implement the sql.Exec
 func Exec(db Execer, querySql string, args ...interface{}) (sql.Result, error) {
-	return db.Exec(querySql, args...)
+	return execContext(db, context.TODO(), querySql, args...)
 }
 func ExecContext(db Execer, ctx context.Context, querySql string, args ...interface{}) (sql.Result, error) {
-	return db.ExecContext(ctx, querySql, args...)
+	return execContext(db, ctx, querySql, args...)
 }
 
 // A way to ran multiply tx
-func ExecMultiTx(tx *sql.Tx, mTx []*MultiTx) error {
+func ExecMultiTx(tx Execer, mTx []*MultiTx) error {
 	return execMultiTx(tx, context.TODO(), mTx)
 }
-func ExecMultiTxContext(tx *sql.Tx, ctx context.Context, mTx []*MultiTx) error {
+func ExecMultiTxContext(tx Execer, ctx context.Context, mTx []*MultiTx) error {
 	return execMultiTx(tx, ctx, mTx)
 }
 
+// A way to ran multiply tx, and return the sql.Result of each MultiTx.
+// When a MultiTx failed or the rows affected not match the ExpectRows, it returns a *MultiTxError
+// with the index and query of the failed one, the caller should rollback the tx.
+// The tx can be a *sql.Tx or a *Tx.
+func ExecMultiTxResults(tx Execer, mTx []*MultiTx) ([]sql.Result, error) {
+	return execMultiTxResults(tx, context.TODO(), mTx)
+}
+func ExecMultiTxResultsContext(tx Execer, ctx context.Context, mTx []*MultiTx) ([]sql.Result, error) {
+	return execMultiTxResults(tx, ctx, mTx)
+}
+
 // Reflect one db data to the struct. the struct tag format like `db:"field_title"`, reference to: http://github.com/jmoiron/sqlx
+// The auto_increment field is back-filled, the 'RETURNING' of postgres and 'OUTPUT INSERTED' of sqlserver need the exec is a Queryer,
+// otherwise it is inserted without back-fill.
 // When you no set the REFLECT_DRV_NAME, you can point out with the drvName
 func InsertStruct(exec Execer, obj interface{}, tbName string, drvNames ...string) (sql.Result, error) {
 	return insertStruct(exec, context.TODO(), obj, tbName, drvNames...)
@@ -136,20 +220,79 @@ func InsertStructContext(exec Execer, ctx context.Context, obj interface{}, tbNa
 	return insertStruct(exec, ctx, obj, tbName, drvNames...)
 }
 
+// Insert a slice of struct to db with multi-row VALUES.
+// The rows are split into chunks by the max bind arguments of the driver, and one sql.Result returned for each chunk.
+// The auto_increment fields are back-filled when the driver can report them, such as mysql and sqlite3.
+// The back-fill of multi rows takes the ids as consecutive from the first one,
+// so it is wrong for mysql when auto_increment_increment > 1, or innodb_autoinc_lock_mode = 2 with the concurrent bulk inserts,
+// insert them one by one with InsertStruct in that case.
+// The multi rows are not back-filled for oracle and sqlserver, the order of the sqlserver OUTPUT rows is not guaranteed.
+// When you no set the REFLECT_DRV_NAME, you can point out with the drvName
+func InsertStructs(exec Execer, objs interface{}, tbName string, drvNames ...string) ([]sql.Result, error) {
+	return insertStructs(exec, context.TODO(), objs, tbName, drvNames...)
+}
+func InsertStructsContext(exec Execer, ctx context.Context, objs interface{}, tbName string, drvNames ...string) ([]sql.Result, error) {
+	return insertStructs(exec, ctx, objs, tbName, drvNames...)
+}
+
+// Update a struct data to db by the key fields, the key field tag format like `db:"id,pk"`,
+// the auto_increment field is taken as a key field by default.
+// It returns an error when no key field found.
+// When you no set the REFLECT_DRV_NAME, you can point out with the drvName
+func UpdateStruct(exec Execer, obj interface{}, tbName string, drvNames ...string) (sql.Result, error) {
+	return updateStruct(exec, context.TODO(), obj, tbName, drvNames...)
+}
+func UpdateStructContext(exec Execer, ctx context.Context, obj interface{}, tbName string, drvNames ...string) (sql.Result, error) {
+	return updateStruct(exec, ctx, obj, tbName, drvNames...)
+}
+
+// Insert a struct data to db, or update the data when the conflict key exists.
+// The conflict key field tag format like `db:"id,pk"` or `db:"name,unique"`, and all the other fields will be updated.
+// It makes 'ON DUPLICATE KEY UPDATE' for mysql, 'ON CONFLICT DO UPDATE' for postgres and sqlite3, 'MERGE' for sqlserver and oracle.
+// The auto_increment field is a conflict key when it is set and marked with `pk`, or no other key field,
+// otherwise it is generated by db, and it is not back-filled by upsert.
+// When you no set the REFLECT_DRV_NAME, you can point out with the drvName
+func UpsertStruct(exec Execer, obj interface{}, tbName string, drvNames ...string) (sql.Result, error) {
+	return upsertStruct(exec, context.TODO(), obj, tbName, drvNames...)
+}
+func UpsertStructContext(exec Execer, ctx context.Context, obj interface{}, tbName string, drvNames ...string) (sql.Result, error) {
+	return upsertStruct(exec, ctx, obj, tbName, drvNames...)
+}
+
+// Delete a struct data from db by the key fields, the key field tag format like `db:"id,pk"`,
+// more than one key fields make a composite key, and the auto_increment field is taken as a key field by default.
+// It returns an error when no key field found.
+// When you no set the REFLECT_DRV_NAME, you can point out with the drvName
+func DeleteStruct(exec Execer, obj interface{}, tbName string, drvNames ...string) (sql.Result, error) {
+	return deleteStruct(exec, context.TODO(), obj, tbName, drvNames...)
+}
+func DeleteStructContext(exec Execer, ctx context.Context, obj interface{}, tbName string, drvNames ...string) (sql.Result, error) {
+	return deleteStruct(exec, ctx, obj, tbName, drvNames...)
+}
+
+// Delete the data from db by the key column name and value, more than one keys make a composite key.
+// When you no set the REFLECT_DRV_NAME, you can point out with the drvName
+func DeleteByKey(exec Execer, tbName string, keys map[string]interface{}, drvNames ...string) (sql.Result, error) {
+	return deleteByKey(exec, context.TODO(), tbName, keys, drvNames...)
+}
+func DeleteByKeyContext(exec Execer, ctx context.Context, tbName string, keys map[string]interface{}, drvNames ...string) (sql.Result, error) {
+	return deleteByKey(exec, ctx, tbName, keys, drvNames...)
+}
+
 // A sql.Query implements
 func Query(db Queryer, querySql string, args ...interface{}) (*sql.Rows, error) {
-	return db.Query(querySql, args...)
+	return queryContext(db, context.TODO(), querySql, args...)
 }
 func QueryContext(db Queryer, ctx context.Context, querySql string, args ...interface{}) (*sql.Rows, error) {
-	return db.QueryContext(ctx, querySql, args...)
+	return queryContext(db, ctx, querySql, args...)
 }
 
 // A sql.QueryRow implements
 func QueryRow(db Queryer, querySql string, args ...interface{}) *sql.Row {
-	return db.QueryRow(querySql, args...)
+	return queryRowContext(db, context.TODO(), querySql, args...)
 }
 func QueryRowContext(db Queryer, ctx context.Context, querySql string, args ...interface{}) *sql.Row {
-	return db.QueryRowContext(ctx, querySql, args...)
+	return queryRowContext(db, ctx, querySql, args...)
 }
 
 // Relect the sql.Rows to a struct.
@@ -0,0 +1,202 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+
+	"github.com/gwaylib/errors"
+)
+
+// The balance modes of the Cluster to choose a replica.
+const (
+	BALANCE_ROUND_ROBIN = 0
+	BALANCE_LEAST_CONN  = 1 // choose the replica with the least in-use connections.
+)
+
+// the context key of forcing the Cluster to read from the primary.
+type primaryContextKey struct{}
+
+// Return a context which makes the Cluster read from the primary,
+// it is used for reading the data just written.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryContextKey{}, true)
+}
+
+func isPrimaryContext(ctx context.Context) bool {
+	force, _ := ctx.Value(primaryContextKey{}).(bool)
+	return force
+}
+
+// The read/write splitting cluster of the cached dbs.
+// The primary is the section of config, and the replicas are the sections listed by its 'replicas' key, like:
+//
+//	[master]
+//	driver: mysql
+//	dsn: ...
+//	replicas: slave1,slave2
+//
+// The queries are sent to an available replica, or the primary if no replica is available;
+// the execs and transactions are sent to the primary.
+// The dbs are resolved from the cache once and refreshed when the cache changed,
+// so it works with the reloading of Watcher and the failover of HealthChecker.
+type Cluster struct {
+	registry    *Registry
+	loader      ConfigLoader
+	sectionName string
+	primary     *DB
+
+	balance int32
+	next    uint32
+
+	// the *clusterDBs resolved from the registry.
+	dbs atomic.Value
+}
+
+// the dbs of cluster resolved from the registry at the version.
+type clusterDBs struct {
+	version  uint64
+	primary  *DB
+	replicas []*DB
+}
+
+// Make a read/write splitting cluster of the section from the config loader, the dbs are cached in the registry.
+func (r *Registry) NewCluster(loader ConfigLoader, sectionName string) (*Cluster, error) {
+	primary, err := r.Get(loader, sectionName)
+	if err != nil {
+		return nil, errors.As(err)
+	}
+	if cfg := primary.Config(); cfg != nil {
+		for _, name := range cfg.Replicas {
+			if _, err := r.Get(loader, name); err != nil {
+				return nil, errors.As(err, name)
+			}
+		}
+	}
+	return &Cluster{registry: r, loader: loader, sectionName: sectionName, primary: primary}, nil
+}
+
+// Set the balance mode to choose a replica, default is BALANCE_ROUND_ROBIN.
+func (c *Cluster) SetBalance(mode int) *Cluster {
+	atomic.StoreInt32(&c.balance, int32(mode))
+	return c
+}
+
+func (c *Cluster) DriverName() string {
+	return c.Primary().DriverName()
+}
+
+// return the dbs of cluster, they are resolved again when the cached dbs of registry changed.
+func (c *Cluster) resolve() *clusterDBs {
+	version := c.registry.cacheVersion()
+	if dbs, ok := c.dbs.Load().(*clusterDBs); ok && dbs.version == version {
+		return dbs
+	}
+	dbs := &clusterDBs{version: version, primary: c.primary}
+	if db, err := c.registry.Get(c.loader, c.sectionName); err == nil {
+		dbs.primary = db
+	}
+	// else keep the last one, the error will be returned when using it.
+	if cfg := dbs.primary.Config(); cfg != nil {
+		for _, name := range cfg.Replicas {
+			db, err := c.registry.Get(c.loader, name)
+			if err != nil {
+				// the failed replica is skipped until the cache changed or Refresh called.
+				continue
+			}
+			dbs.replicas = append(dbs.replicas, db)
+		}
+	}
+	c.dbs.Store(dbs)
+	return dbs
+}
+
+// Resolve the dbs from the registry again at the next using, such as retrying the failed replicas.
+func (c *Cluster) Refresh() {
+	c.dbs.Store(&clusterDBs{})
+}
+
+// Return the primary db.
+func (c *Cluster) Primary() *DB {
+	return c.resolve().primary
+}
+
+// Return the available replicas, the replica which is down by the HealthChecker is excluded.
+func (c *Cluster) Replicas() []*DB {
+	all := c.resolve().replicas
+	replicas := make([]*DB, 0, len(all))
+	for _, db := range all {
+		if db.IsClose() || db.Health().State == HEALTH_DOWN {
+			continue
+		}
+		replicas = append(replicas, db)
+	}
+	return replicas
+}
+
+// Return a replica by the balance mode, or the primary if no replica is available.
+func (c *Cluster) Replica() *DB {
+	replicas := c.Replicas()
+	if len(replicas) == 0 {
+		return c.Primary()
+	}
+	if atomic.LoadInt32(&c.balance) == BALANCE_LEAST_CONN {
+		least := replicas[0]
+		inUse := least.Stats().InUse
+		for _, db := range replicas[1:] {
+			if n := db.Stats().InUse; n < inUse {
+				least, inUse = db, n
+			}
+		}
+		return least
+	}
+	idx := atomic.AddUint32(&c.next, 1) - 1
+	return replicas[idx%uint32(len(replicas))]
+}
+
+// return the queryer for the context, it is the tx of primary if the context carries one.
+func (c *Cluster) queryer(ctx context.Context) Queryer {
+	primary := c.Primary()
+	if tx, ok := ctx.Value(txContextKey{primary}).(*Tx); ok {
+		return tx
+	}
+	if isPrimaryContext(ctx) {
+		return primary
+	}
+	return c.Replica()
+}
+
+// implement the Queryer
+func (c *Cluster) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.QueryContext(context.TODO(), query, args...)
+}
+func (c *Cluster) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.QueryRowContext(context.TODO(), query, args...)
+}
+func (c *Cluster) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.queryer(ctx).QueryContext(ctx, query, args...)
+}
+func (c *Cluster) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return c.queryer(ctx).QueryRowContext(ctx, query, args...)
+}
+
+// implement the Execer
+func (c *Cluster) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.Primary().Exec(query, args...)
+}
+func (c *Cluster) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.Primary().ExecContext(ctx, query, args...)
+}
+
+// Begin a transaction on the primary.
+func (c *Cluster) Begin() (*sql.Tx, error) {
+	return c.Primary().Begin()
+}
+func (c *Cluster) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return c.Primary().BeginTx(ctx, opts)
+}
+
+// Run fn in a transaction of the primary, see the WithTx of DB.
+func (c *Cluster) WithTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *Tx) error) error {
+	return c.Primary().WithTx(ctx, opts, fn)
+}
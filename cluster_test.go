@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+)
+
+func TestCluster(t *testing.T) {
+	handler := func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		return []string{"id"}, [][]driver.Value{{int64(1)}}, nil
+	}
+	master, masterDrv := newTestDB("mysql", handler)
+	slave1, slave1Drv := newTestDB("mysql", handler)
+	slave2, slave2Drv := newTestDB("mysql", handler)
+	master.cfg = &Config{Section: "master", Replicas: []string{"slave1", "slave2"}}
+
+	fileName := "cluster_test.cfg"
+	RegCache(fileName, "master", master)
+	RegCache(fileName, "slave1", slave1)
+	RegCache(fileName, "slave2", slave2)
+	defer Close(master)
+
+	c := GetCluster(fileName, "master")
+	if c.DriverName() != "mysql" || len(c.Replicas()) != 2 {
+		t.Fatal(c.DriverName(), c.Replicas())
+	}
+
+	// the hooks run on the chosen replica
+	events := []string{}
+	slave1.AddHook(&testHook{name: "slave1", events: &events})
+	master.AddHook(&testHook{name: "master", events: &events})
+
+	id := 0
+	for i := 0; i < 4; i++ {
+		if err := QueryElem(c, &id, "SELECT id FROM user"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(slave1Drv.Queries()) != 2 || len(slave2Drv.Queries()) != 2 || len(masterDrv.Queries()) != 0 {
+		t.Fatal(slave1Drv.Queries(), slave2Drv.Queries(), masterDrv.Queries())
+	}
+	if len(events) != 4 || events[0] != "slave1 before query rows=-1 err=false ctx=" {
+		t.Fatal(events)
+	}
+
+	// read your writes
+	if _, err := Exec(c, "UPDATE user SET name=?", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := QueryElemContext(c, WithPrimary(context.TODO()), &id, "SELECT id FROM user"); err != nil {
+		t.Fatal(err)
+	}
+	if len(masterDrv.Queries()) != 2 {
+		t.Fatal(masterDrv.Queries())
+	}
+
+	// the query in transaction
+	if err := c.WithTx(context.TODO(), nil, func(tx *Tx) error {
+		return QueryElemContext(c, tx.Context(), &id, "SELECT id FROM user FOR UPDATE")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if q := masterDrv.Queries(); len(q) != 5 || q[3] != "SELECT id FROM user FOR UPDATE" {
+		t.Fatal(q)
+	}
+
+	// the replaced replica is resolved again
+	replicas := c.Replicas()
+	if c.Replicas()[0] != replicas[0] {
+		t.Fatal("expect the resolved replicas cached")
+	}
+	newSlave1, _ := newTestDB("mysql", handler)
+	RegCache(fileName, "slave1", newSlave1)
+	defer Close(newSlave1)
+	if replicas := c.Replicas(); len(replicas) != 2 || replicas[0] != newSlave1 {
+		t.Fatal("expect the new slave1")
+	}
+	RegCache(fileName, "slave1", slave1)
+
+	// fallback to the primary when no replica available
+	Close(slave1)
+	c.SetBalance(BALANCE_LEAST_CONN)
+	if c.Replica() != slave2 {
+		t.Fatal("expect slave2")
+	}
+	Close(slave2)
+	master.cfg = &Config{Section: "master"}
+	if c.Replica() != master {
+		t.Fatal("expect master")
+	}
+}
+
+func TestClusterInsertStruct(t *testing.T) {
+	for _, drvName := range []string{DRV_NAME_POSTGRES, DRV_NAME_SQLSERVER} {
+		handler := func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+			return []string{"id"}, [][]driver.Value{{int64(1)}, {int64(2)}}, nil
+		}
+		master, masterDrv := newTestDB(drvName, handler)
+		slave1, slave1Drv := newTestDB(drvName, handler)
+		master.cfg = &Config{Section: "master", Replicas: []string{"slave1"}}
+
+		fileName := "cluster_insert_test_" + drvName + ".cfg"
+		RegCache(fileName, "master", master)
+		RegCache(fileName, "slave1", slave1)
+
+		c := GetCluster(fileName, "master")
+		s := &ReflectTestStruct6{Name: "a"}
+		if _, err := InsertStruct(c, s, "testing"); err != nil {
+			t.Fatal(err)
+		}
+		ss := []*ReflectTestStruct6{{Name: "b"}, {Name: "c"}}
+		if _, err := InsertStructs(c, ss, "testing"); err != nil {
+			t.Fatal(err)
+		}
+		if len(masterDrv.Queries()) != 2 || len(slave1Drv.Queries()) != 0 || s.Id != 1 {
+			t.Fatal(drvName, masterDrv.Queries(), slave1Drv.Queries(), s.Id)
+		}
+		Close(master)
+		Close(slave1)
+	}
+}
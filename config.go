@@ -0,0 +1,333 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/go-ini/ini"
+	"github.com/gwaylib/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// The db config of a section.
+type Config struct {
+	// the source and section which the config loaded from.
+	Source  string
+	Section string
+
+	DriverName string
+	Dsn        string
+
+	// the dsns to switch to in order when the db is down, it is used by the HealthChecker.
+	FallbackDsns []string
+
+	// the files which the secrets of dsn and password read from, they are watched by the Watcher for rotating.
+	SecretFiles []string
+
+	// http://techblog.en.klab-blogs.com/archives/31093990.html
+	LifeTime     time.Duration
+	MaxOpenConns int
+	MaxIdleConns int // less than 0 is not set, and using the default of sql.DB.
+	MaxIdleTime  time.Duration
+
+	// ping the db after open, and the ping is canceled by the ConnectTimeout when it is set.
+	PingOnOpen     bool
+	ConnectTimeout time.Duration
+
+	// the section names of the replicas, it is used by the Cluster.
+	Replicas []string
+
+	// log the query slower than the threshold by a SlowQueryHook when it is set,
+	// and the logs are limited by the rate per second, 0 is unlimited.
+	SlowThreshold time.Duration
+	SlowLogRate   int
+}
+
+// Load the db config from a source, such as a file or the environment.
+type ConfigLoader interface {
+	// Return the source of config, such as the file name,
+	// it is used as the cache key with the section name.
+	Source() string
+
+	// Load the db config of the section.
+	Load(sectionName string) (*Config, error)
+}
+
+// the section name of defaults, it is inherited by the other sections.
+const defaultSectionName = "default"
+
+// parse the db config by the getKey of section,
+// the key not found in the section should be inherited from the default section by getKey.
+func parseConfig(source, sectionName string, getKey func(name string) (string, bool)) (*Config, error) {
+	var err error
+	c := &Config{Source: source, Section: sectionName, MaxIdleConns: -1, SlowLogRate: defaultSlowLogRate}
+	drvName, ok := getKey("driver")
+	if !ok {
+		return nil, errors.New("not found 'driver'").As(source, sectionName)
+	}
+	c.DriverName = drvName
+	dsn, ok := getKey("dsn")
+	if !ok {
+		return nil, errors.New("not found 'dsn'").As(source, sectionName)
+	}
+	c.Dsn, err = expandSecrets(dsn, &c.SecretFiles)
+	if err != nil {
+		return nil, errors.As(err, source, sectionName, "dsn")
+	}
+
+	// merge the password into dsn, so it can be kept out of the config file.
+	password, hasPassword := getKey("password")
+	if hasPassword {
+		password, err = expandSecrets(password, &c.SecretFiles)
+		if err != nil {
+			return nil, errors.As(err, source, sectionName, "password")
+		}
+	} else if passwordFile, ok := getKey("password_file"); ok {
+		ref := strings.TrimPrefix(strings.TrimSpace(passwordFile), "file:")
+		c.SecretFiles = append(c.SecretFiles, secretFileName(ref))
+		password, err = resolveFileSecret(ref)
+		if err != nil {
+			return nil, errors.As(err, source, sectionName, "password_file")
+		}
+		hasPassword = true
+	}
+
+	// the fallback dsns are separated by '|'
+	if fallbacks, ok := getKey("fallback_dsn"); ok {
+		for _, fallback := range strings.Split(fallbacks, "|") {
+			if fallback = strings.TrimSpace(fallback); len(fallback) == 0 {
+				continue
+			}
+			fallback, err = expandSecrets(fallback, &c.SecretFiles)
+			if err != nil {
+				return nil, errors.As(err, source, sectionName, "fallback_dsn")
+			}
+			c.FallbackDsns = append(c.FallbackDsns, fallback)
+		}
+	}
+
+	if hasPassword {
+		c.Dsn, err = setDSNPassword(drvName, c.Dsn, password)
+		if err != nil {
+			return nil, errors.As(err, source, sectionName, redactDSN(drvName, c.Dsn))
+		}
+		for i, fallback := range c.FallbackDsns {
+			c.FallbackDsns[i], err = setDSNPassword(drvName, fallback, password)
+			if err != nil {
+				return nil, errors.As(err, source, sectionName, redactDSN(drvName, fallback))
+			}
+		}
+	}
+
+	for _, opt := range []struct {
+		name  string
+		parse func(val string) error
+	}{
+		{"life_time", func(val string) (err error) { c.LifeTime, err = parseSeconds(val); return }},
+		{"max_open_conns", func(val string) (err error) { c.MaxOpenConns, err = strconv.Atoi(val); return }},
+		{"max_idle_conns", func(val string) (err error) { c.MaxIdleConns, err = strconv.Atoi(val); return }},
+		{"max_idle_time", func(val string) (err error) { c.MaxIdleTime, err = parseSeconds(val); return }},
+		{"ping_on_open", func(val string) (err error) { c.PingOnOpen, err = strconv.ParseBool(val); return }},
+		{"connect_timeout", func(val string) (err error) { c.ConnectTimeout, err = parseSeconds(val); return }},
+		{"replicas", func(val string) error { c.Replicas = splitNames(val); return nil }},
+		{"slow_threshold", func(val string) (err error) { c.SlowThreshold, err = parseSeconds(val); return }},
+		{"slow_log_rate", func(val string) (err error) { c.SlowLogRate, err = strconv.Atoi(val); return }},
+	} {
+		val, ok := getKey(opt.name)
+		if !ok {
+			continue
+		}
+		if err := opt.parse(strings.TrimSpace(val)); err != nil {
+			return nil, errors.New("error '"+opt.name+"' value").As(source, sectionName, val)
+		}
+	}
+	if c.MaxOpenConns < 0 {
+		return nil, errors.New("error 'max_open_conns' value").As(source, sectionName, c.MaxOpenConns)
+	}
+	if c.SlowLogRate < 0 {
+		return nil, errors.New("error 'slow_log_rate' value").As(source, sectionName, c.SlowLogRate)
+	}
+	return c, nil
+}
+
+// split the names by comma, and the empty is ignored.
+func splitNames(val string) []string {
+	names := []string{}
+	for _, name := range strings.Split(val, ",") {
+		if name = strings.TrimSpace(name); len(name) > 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// parse the value of seconds, a duration format like '1m30s' is supported too.
+func parseSeconds(val string) (time.Duration, error) {
+	sec, err := strconv.ParseInt(val, 10, 64)
+	if err == nil {
+		if sec < 0 {
+			return 0, errors.New("negative value").As(val)
+		}
+		return time.Duration(sec) * time.Second, nil
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, errors.As(err, val)
+	}
+	if d < 0 {
+		return 0, errors.New("negative value").As(val)
+	}
+	return d, nil
+}
+
+// the ini file loader
+type iniLoader struct {
+	fileName string
+}
+
+// Make a loader of ini file, it is the default loader of GetCache.
+func NewIniLoader(fileName string) ConfigLoader {
+	return &iniLoader{fileName: fileName}
+}
+
+func (l *iniLoader) Source() string {
+	return l.fileName
+}
+
+func (l *iniLoader) Load(sectionName string) (*Config, error) {
+	cfg, err := ini.Load(l.fileName)
+	if err != nil {
+		return nil, errors.As(err, l.fileName)
+	}
+	section, err := cfg.GetSection(sectionName)
+	if err != nil {
+		return nil, errors.As(err, l.fileName, sectionName)
+	}
+	defSection, _ := cfg.GetSection(defaultSectionName)
+	return parseConfig(l.fileName, sectionName, func(name string) (string, bool) {
+		if key, err := section.GetKey(name); err == nil {
+			return key.String(), true
+		}
+		if defSection != nil {
+			if key, err := defSection.GetKey(name); err == nil {
+				return key.String(), true
+			}
+		}
+		return "", false
+	})
+}
+
+// the loader of file which decoded to sections, like json, yaml and toml.
+type mapLoader struct {
+	fileName string
+	decode   func(data []byte, v *map[string]map[string]interface{}) error
+}
+
+// Make a loader of json file, the file content like:
+//
+//	{"master": {"driver": "mysql", "dsn": "...", "life_time": 7200}}
+func NewJSONLoader(fileName string) ConfigLoader {
+	return &mapLoader{fileName: fileName, decode: func(data []byte, v *map[string]map[string]interface{}) error {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		// keep the numbers as they are, the float64 of large number is formatted like '1e+06'.
+		decoder.UseNumber()
+		return decoder.Decode(v)
+	}}
+}
+
+// Make a loader of yaml file, the file content like:
+//
+//	master:
+//	  driver: mysql
+//	  dsn: ...
+func NewYAMLLoader(fileName string) ConfigLoader {
+	return &mapLoader{fileName: fileName, decode: func(data []byte, v *map[string]map[string]interface{}) error {
+		return yaml.Unmarshal(data, v)
+	}}
+}
+
+// Make a loader of toml file, the file content like:
+//
+//	[master]
+//	driver = "mysql"
+//	dsn = "..."
+func NewTOMLLoader(fileName string) ConfigLoader {
+	return &mapLoader{fileName: fileName, decode: func(data []byte, v *map[string]map[string]interface{}) error {
+		return toml.Unmarshal(data, v)
+	}}
+}
+
+func (l *mapLoader) Source() string {
+	return l.fileName
+}
+
+func (l *mapLoader) Load(sectionName string) (*Config, error) {
+	data, err := ioutil.ReadFile(l.fileName)
+	if err != nil {
+		return nil, errors.As(err, l.fileName)
+	}
+	sections := map[string]map[string]interface{}{}
+	if err := l.decode(data, &sections); err != nil {
+		return nil, errors.As(err, l.fileName)
+	}
+	section, ok := sections[sectionName]
+	if !ok {
+		return nil, errors.New("section not found").As(l.fileName, sectionName)
+	}
+	defSection := sections[defaultSectionName]
+	return parseConfig(l.fileName, sectionName, func(name string) (string, bool) {
+		val, ok := section[name]
+		if !ok {
+			val, ok = defSection[name]
+		}
+		if !ok || val == nil {
+			return "", false
+		}
+		return configValue(val), true
+	})
+}
+
+// return the string of the decoded value, the float is formatted without exponent.
+func configValue(val interface{}) string {
+	switch v := val.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	}
+	return fmt.Sprint(val)
+}
+
+// the environment loader
+type envLoader struct {
+	prefix string
+}
+
+// Make a loader of environment variables, the variable name is PREFIX_SECTION_KEY in upper case,
+// for example: DB_MASTER_DRIVER, DB_MASTER_DSN, DB_MASTER_LIFE_TIME, and DB_DEFAULT_* for the defaults.
+func NewEnvLoader(prefix string) ConfigLoader {
+	return &envLoader{prefix: prefix}
+}
+
+func (l *envLoader) Source() string {
+	return "env:" + l.prefix
+}
+
+func (l *envLoader) Load(sectionName string) (*Config, error) {
+	envName := func(section, key string) string {
+		return strings.ToUpper(l.prefix + "_" + section + "_" + key)
+	}
+	return parseConfig(l.Source(), sectionName, func(name string) (string, bool) {
+		if val, ok := os.LookupEnv(envName(sectionName, name)); ok {
+			return val, true
+		}
+		return os.LookupEnv(envName(defaultSectionName, name))
+	})
+}
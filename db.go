@@ -15,7 +15,22 @@ type DB struct {
 	*sql.DB
 	driverName string
 	isClose    bool
+	txRetry    int
 	mu         sync.Mutex
+
+	// the config which the db opened from, nil if it is not opened by config.
+	cfg *Config
+	// the index of dsn in config, 0 is the Dsn, and the others are the FallbackDsns.
+	dsnIdx int
+
+	health Health
+	hooks  []Hook
+	// the hook made by the SlowThreshold of config, it is not inherited by the reopened db.
+	slowHook *SlowQueryHook
+
+	// the registry and key which the db cached in.
+	registry *Registry
+	key      CacheKey
 }
 
 func newDB(drvName string, db *sql.DB) *DB {
@@ -25,10 +40,53 @@ func newDB(drvName string, db *sql.DB) *DB {
 	}
 }
 
+// inherit the hooks added by AddHook and the settings of transaction from the old db,
+// it is used when the db is reopened by the Watcher or the HealthChecker.
+func (db *DB) inherit(old *DB) {
+	old.mu.Lock()
+	oldHooks, slowHook, txRetry := old.hooks, old.slowHook, old.txRetry
+	old.mu.Unlock()
+
+	hooks := []Hook{}
+	for _, h := range oldHooks {
+		if slowHook != nil && h == Hook(slowHook) {
+			continue
+		}
+		hooks = append(hooks, h)
+	}
+	db.AddHook(hooks...)
+	db.mu.Lock()
+	db.txRetry = txRetry
+	db.mu.Unlock()
+}
+
 func (db *DB) DriverName() string {
 	return db.driverName
 }
 
+// Return the sql dialect of the driver.
+func (db *DB) Dialect() Dialect {
+	return GetDialect(db.driverName)
+}
+
+// Return the config which the db opened from, nil if it is not opened by a ConfigLoader.
+func (db *DB) Config() *Config {
+	return db.cfg
+}
+
+// Return the index of dsn which the db opened with, 0 is the Dsn of config,
+// and the others are the FallbackDsns switched by the HealthChecker.
+func (db *DB) DsnIndex() int {
+	return db.dsnIdx
+}
+
+// Return the health state checked by the HealthChecker.
+func (db *DB) Health() Health {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.health
+}
+
 func (db *DB) IsClose() bool {
 	db.mu.Lock()
 	defer db.mu.Unlock()
@@ -37,9 +95,15 @@ func (db *DB) IsClose() bool {
 
 func (db *DB) Close() error {
 	db.mu.Lock()
-	defer db.mu.Unlock()
-
 	db.isClose = true
-	rmCache(db)
-	return db.DB.Close()
+	registry, key := db.registry, db.key
+	db.mu.Unlock()
+
+	if registry == nil {
+		return db.DB.Close()
+	}
+	registry.remove(key, db)
+	err := db.DB.Close()
+	registry.notifyClose(key, db, err)
+	return err
 }
@@ -0,0 +1,380 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Dialect describes the sql differences of a database driver,
+// it is used to build the sql of InsertStruct, UpdateStruct, UpsertStruct etc.
+type Dialect interface {
+	// Quote the identifier of table or column.
+	QuoteIdent(name string) string
+
+	// Return the bind variable of the n-th argument, n start with 1.
+	Placeholder(n int) string
+
+	// Return the clause to fetch back the col of inserted rows,
+	// it should return empty when the driver implements the sql.Result.LastInsertId.
+	// The insert with returning clause will be queried for the col,
+	// or be executed with a sql.Out argument if the clause has a '?' bind variable, like 'RETURNING col INTO ?'.
+	ReturningClause(col string) string
+
+	// Return the first id of a multi-row insert by the sql.Result.LastInsertId,
+	// return false if the driver can not report it.
+	FirstInsertId(lastInsertId int64, rows int) (int64, bool)
+
+	// Return the max number of bind arguments in one statement,
+	// and the max rows of one insert statement, 0 is no limit.
+	MaxParams() (params int, rows int)
+
+	// Build the insert sql of rows, names are the unquoted column names,
+	// returning is the result of ReturningClause or empty.
+	// The arguments bind with '?', and it will be converted by Rebind.
+	InsertSql(tbName string, names []string, rows int, returning string) string
+
+	// Return the sql to create, release, and rollback to a savepoint for the nested transaction,
+	// the release sql is empty when the driver no need to release it.
+	SavepointSql(name string) string
+	ReleaseSavepointSql(name string) string
+	RollbackSavepointSql(name string) string
+
+	// Build the upsert sql of one row, names are the unquoted column names,
+	// keys are the conflict columns, updates are the columns to update when conflict.
+	// The arguments bind with '?', and it will be converted by Rebind.
+	UpsertSql(tbName string, names, keys, updates []string) string
+}
+
+var (
+	dialectLock = sync.RWMutex{}
+	dialects    = map[string]Dialect{}
+
+	// for the driver names not registered, such as "mysql_proxy" which contains "mysql".
+	dialectAlias = []string{
+		DRV_NAME_ORACLE, "oci8",
+		DRV_NAME_POSTGRES,
+		DRV_NAME_SQLSERVER, "mssql",
+		DRV_NAME_MYSQL,
+		DRV_NAME_SQLITE3,
+	}
+	defaultDialect Dialect = &ansiDialect{}
+)
+
+func init() {
+	mysql := &mysqlDialect{}
+	postgres := &postgresDialect{}
+	sqlite3 := &sqlite3Dialect{}
+	sqlserver := &sqlserverDialect{}
+	oracle := &oracleDialect{}
+
+	RegisterDialect(DRV_NAME_MYSQL, mysql)
+	RegisterDialect(DRV_NAME_POSTGRES, postgres)
+	RegisterDialect("pgx", postgres)
+	RegisterDialect(DRV_NAME_SQLITE3, sqlite3)
+	RegisterDialect(DRV_NAME_SQLSERVER, sqlserver)
+	RegisterDialect("mssql", sqlserver)
+	RegisterDialect(DRV_NAME_ORACLE, oracle)
+	RegisterDialect("oci8", oracle)
+	RegisterDialect("godror", oracle)
+}
+
+// Register a dialect for the driver name, it will replace the old one if exists.
+// For example:
+//
+//	func init(){
+//	    database.RegisterDialect("tidb", database.GetDialect(database.DRV_NAME_MYSQL))
+//	}
+func RegisterDialect(drvName string, d Dialect) {
+	dialectLock.Lock()
+	defer dialectLock.Unlock()
+	dialects[drvName] = d
+}
+
+// Get the dialect of the driver name.
+// If the driver name not registered, it will match the builtin driver name which contained by drvName,
+// and return the ansi dialect (quote with '"' and bind with '?') if still not found.
+func GetDialect(drvName string) Dialect {
+	dialectLock.RLock()
+	defer dialectLock.RUnlock()
+	d, ok := dialects[drvName]
+	if ok {
+		return d
+	}
+	for _, alias := range dialectAlias {
+		if strings.Index(drvName, alias) > -1 {
+			return dialects[alias]
+		}
+	}
+	return defaultDialect
+}
+
+// the default dialect
+type ansiDialect struct{}
+
+func (d *ansiDialect) QuoteIdent(name string) string {
+	return "\"" + name + "\""
+}
+func (d *ansiDialect) Placeholder(n int) string {
+	return "?"
+}
+func (d *ansiDialect) ReturningClause(col string) string {
+	return ""
+}
+func (d *ansiDialect) FirstInsertId(lastInsertId int64, rows int) (int64, bool) {
+	return 0, false
+}
+func (d *ansiDialect) MaxParams() (int, int) {
+	return 999, 0
+}
+func (d *ansiDialect) SavepointSql(name string) string {
+	return "SAVEPOINT " + name
+}
+func (d *ansiDialect) ReleaseSavepointSql(name string) string {
+	return "RELEASE SAVEPOINT " + name
+}
+func (d *ansiDialect) RollbackSavepointSql(name string) string {
+	return "ROLLBACK TO SAVEPOINT " + name
+}
+func (d *ansiDialect) InsertSql(tbName string, names []string, rows int, returning string) string {
+	return insertValuesSql(d, tbName, names, rows, "", returning)
+}
+func (d *ansiDialect) UpsertSql(tbName string, names, keys, updates []string) string {
+	return onConflictSql(d, tbName, names, keys, updates)
+}
+
+type mysqlDialect struct {
+	ansiDialect
+}
+
+func (d *mysqlDialect) QuoteIdent(name string) string {
+	return "`" + name + "`"
+}
+func (d *mysqlDialect) FirstInsertId(lastInsertId int64, rows int) (int64, bool) {
+	// mysql returns the id of the first row,
+	// and the ids are consecutive when auto_increment_increment = 1 and the lock mode keeps them.
+	return lastInsertId, true
+}
+func (d *mysqlDialect) MaxParams() (int, int) {
+	return 65535, 0
+}
+func (d *mysqlDialect) InsertSql(tbName string, names []string, rows int, returning string) string {
+	return insertValuesSql(d, tbName, names, rows, "", returning)
+}
+func (d *mysqlDialect) UpsertSql(tbName string, names, keys, updates []string) string {
+	sets := make([]string, len(updates))
+	for i, name := range updates {
+		name = d.QuoteIdent(name)
+		sets[i] = name + "=VALUES(" + name + ")"
+	}
+	if len(sets) == 0 {
+		// do nothing when conflict
+		name := d.QuoteIdent(keys[0])
+		sets = append(sets, name+"="+name)
+	}
+	insertSql := insertValuesSql(d, tbName, names, 1, "", "")
+	return insertSql[:len(insertSql)-1] + " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ",") + ";"
+}
+
+type postgresDialect struct {
+	ansiDialect
+}
+
+func (d *postgresDialect) Placeholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+func (d *postgresDialect) ReturningClause(col string) string {
+	return "RETURNING " + d.QuoteIdent(col)
+}
+func (d *postgresDialect) MaxParams() (int, int) {
+	return 65535, 0
+}
+func (d *postgresDialect) InsertSql(tbName string, names []string, rows int, returning string) string {
+	return insertValuesSql(d, tbName, names, rows, "", returning)
+}
+func (d *postgresDialect) UpsertSql(tbName string, names, keys, updates []string) string {
+	return onConflictSql(d, tbName, names, keys, updates)
+}
+
+type sqlite3Dialect struct {
+	ansiDialect
+}
+
+// sqlite3 implements the sql.Result.LastInsertId, so the RETURNING of 3.35+ is not need.
+func (d *sqlite3Dialect) FirstInsertId(lastInsertId int64, rows int) (int64, bool) {
+	// sqlite3 returns the id of the last row.
+	return lastInsertId - int64(rows) + 1, true
+}
+func (d *sqlite3Dialect) MaxParams() (int, int) {
+	// SQLITE_MAX_VARIABLE_NUMBER is 999 before 3.32.0, and 32766 since.
+	return 999, 0
+}
+
+type sqlserverDialect struct {
+	ansiDialect
+}
+
+func (d *sqlserverDialect) QuoteIdent(name string) string {
+	return "[" + name + "]"
+}
+func (d *sqlserverDialect) Placeholder(n int) string {
+	return fmt.Sprintf("@p%d", n)
+}
+func (d *sqlserverDialect) ReturningClause(col string) string {
+	return "OUTPUT INSERTED." + d.QuoteIdent(col)
+}
+func (d *sqlserverDialect) MaxParams() (int, int) {
+	// 2100 parameters include the rpc parameter, and 1000 rows limited for one VALUES.
+	return 2099, 1000
+}
+func (d *sqlserverDialect) SavepointSql(name string) string {
+	return "SAVE TRANSACTION " + name
+}
+func (d *sqlserverDialect) ReleaseSavepointSql(name string) string {
+	return ""
+}
+func (d *sqlserverDialect) RollbackSavepointSql(name string) string {
+	return "ROLLBACK TRANSACTION " + name
+}
+func (d *sqlserverDialect) InsertSql(tbName string, names []string, rows int, returning string) string {
+	// the OUTPUT clause is before the VALUES.
+	return insertValuesSql(d, tbName, names, rows, returning, "")
+}
+func (d *sqlserverDialect) UpsertSql(tbName string, names, keys, updates []string) string {
+	inputs := bindVars(len(names))
+	buf := &strings.Builder{}
+	fmt.Fprintf(buf, "MERGE INTO %s AS t USING (VALUES (%s)) AS s (%s) ON %s",
+		tbName, strings.Join(inputs, ","), strings.Join(quoteIdents(d, "", names), ","), mergeOn(d, keys),
+	)
+	mergeMatched(d, buf, names, updates)
+	// sqlserver need end with ';' for merge
+	buf.WriteString(";")
+	return buf.String()
+}
+
+type oracleDialect struct {
+	ansiDialect
+}
+
+func (d *oracleDialect) Placeholder(n int) string {
+	return fmt.Sprintf(":%d", n)
+}
+func (d *oracleDialect) ReturningClause(col string) string {
+	return "RETURNING " + d.QuoteIdent(col) + " INTO ?"
+}
+func (d *oracleDialect) MaxParams() (int, int) {
+	return 65535, 0
+}
+func (d *oracleDialect) ReleaseSavepointSql(name string) string {
+	// oracle release the savepoint when commit.
+	return ""
+}
+func (d *oracleDialect) InsertSql(tbName string, names []string, rows int, returning string) string {
+	if rows == 1 {
+		sql := insertValuesSql(d, tbName, names, rows, "", returning)
+		// oracle not support the ';' end.
+		return sql[:len(sql)-1]
+	}
+	quoteNames := strings.Join(quoteIdents(d, "", names), ",")
+	buf := &strings.Builder{}
+	buf.WriteString("INSERT ALL")
+	for i := 0; i < rows; i++ {
+		inputs := bindVars(len(names))
+		fmt.Fprintf(buf, " INTO %s (%s) VALUES (%s)", tbName, quoteNames, strings.Join(inputs, ","))
+	}
+	buf.WriteString(" SELECT 1 FROM dual")
+	return buf.String()
+}
+func (d *oracleDialect) UpsertSql(tbName string, names, keys, updates []string) string {
+	inputs := bindVars(len(names))
+	quoteNames := quoteIdents(d, "", names)
+	selects := make([]string, len(names))
+	for i, name := range quoteNames {
+		selects[i] = inputs[i] + " " + name
+	}
+	buf := &strings.Builder{}
+	fmt.Fprintf(buf, "MERGE INTO %s t USING (SELECT %s FROM dual) s ON (%s)",
+		tbName, strings.Join(selects, ","), mergeOn(d, keys),
+	)
+	mergeMatched(d, buf, names, updates)
+	return buf.String()
+}
+
+// return n '?' bind variables
+func bindVars(n int) []string {
+	inputs := make([]string, n)
+	for i := 0; i < n; i++ {
+		inputs[i] = "?"
+	}
+	return inputs
+}
+
+// return the quoted names with prefix
+func quoteIdents(d Dialect, prefix string, names []string) []string {
+	quotes := make([]string, len(names))
+	for i, name := range names {
+		quotes[i] = prefix + d.QuoteIdent(name)
+	}
+	return quotes
+}
+
+// INSERT INTO tbName (names) output VALUES (...),(...) returning;
+func insertValuesSql(d Dialect, tbName string, names []string, rows int, output, returning string) string {
+	buf := &strings.Builder{}
+	fmt.Fprintf(buf, "INSERT INTO %s (%s) ", tbName, strings.Join(quoteIdents(d, "", names), ","))
+	if len(output) > 0 {
+		buf.WriteString(output + " ")
+	}
+	buf.WriteString("VALUES ")
+	for i := 0; i < rows; i++ {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		fmt.Fprintf(buf, "(%s)", strings.Join(bindVars(len(names)), ","))
+	}
+	if len(returning) > 0 {
+		buf.WriteString(" " + returning)
+	}
+	buf.WriteString(";")
+	return buf.String()
+}
+
+// INSERT ... ON CONFLICT (keys) DO UPDATE SET ...
+func onConflictSql(d Dialect, tbName string, names, keys, updates []string) string {
+	action := "DO NOTHING"
+	if len(updates) > 0 {
+		sets := make([]string, len(updates))
+		for i, name := range updates {
+			name = d.QuoteIdent(name)
+			sets[i] = name + "=EXCLUDED." + name
+		}
+		action = "DO UPDATE SET " + strings.Join(sets, ",")
+	}
+	insertSql := insertValuesSql(d, tbName, names, 1, "", "")
+	return fmt.Sprintf("%s ON CONFLICT (%s) %s;", insertSql[:len(insertSql)-1], strings.Join(quoteIdents(d, "", keys), ","), action)
+}
+
+// t.key1=s.key1 AND t.key2=s.key2
+func mergeOn(d Dialect, keys []string) string {
+	ons := make([]string, len(keys))
+	for i, name := range keys {
+		name = d.QuoteIdent(name)
+		ons[i] = "t." + name + "=s." + name
+	}
+	return strings.Join(ons, " AND ")
+}
+
+// WHEN MATCHED THEN UPDATE SET ... WHEN NOT MATCHED THEN INSERT ...
+func mergeMatched(d Dialect, buf *strings.Builder, names, updates []string) {
+	if len(updates) > 0 {
+		sets := make([]string, len(updates))
+		for i, name := range updates {
+			name = d.QuoteIdent(name)
+			sets[i] = "t." + name + "=s." + name
+		}
+		fmt.Fprintf(buf, " WHEN MATCHED THEN UPDATE SET %s", strings.Join(sets, ","))
+	}
+	fmt.Fprintf(buf, " WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s)",
+		strings.Join(quoteIdents(d, "", names), ","), strings.Join(quoteIdents(d, "s.", names), ","),
+	)
+}
@@ -0,0 +1,24 @@
+package database
+
+import "testing"
+
+func TestGetDialect(t *testing.T) {
+	if GetDialect("pgx").Placeholder(1) != "$1" {
+		t.Fatal("expect postgres dialect for pgx")
+	}
+	if GetDialect("mysql_proxy").QuoteIdent("a") != "`a`" {
+		t.Fatal("expect mysql dialect for mysql_proxy")
+	}
+	if GetDialect("unknown").QuoteIdent("a") != `"a"` {
+		t.Fatal("expect ansi dialect for unknown")
+	}
+
+	RegisterDialect("tidb", GetDialect(DRV_NAME_MYSQL))
+	exec := &testExecer{}
+	if _, err := DeleteByKey(exec, "testing", map[string]interface{}{"id": 1}, "tidb"); err != nil {
+		t.Fatal(err)
+	}
+	if exec.query != "DELETE FROM testing WHERE `id`=?" {
+		t.Fatal(exec.query)
+	}
+}
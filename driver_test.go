@@ -0,0 +1,153 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// a fake driver for testing, it records the sql and return the result by handler.
+type testDriver struct {
+	mu      sync.Mutex
+	queries []string
+	args    [][]driver.NamedValue
+
+	// return the columns and rows for query, nil for exec
+	handler func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error)
+}
+
+func init() {
+	sql.Register("testdb", &testDriver{})
+}
+
+func newTestDB(drvName string, handler func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error)) (*DB, *testDriver) {
+	drv := &testDriver{handler: handler}
+	return NewDB(drvName, sql.OpenDB(drv)), drv
+}
+
+func (d *testDriver) LastQuery() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.queries) == 0 {
+		return ""
+	}
+	return d.queries[len(d.queries)-1]
+}
+
+func (d *testDriver) Queries() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string{}, d.queries...)
+}
+
+func (d *testDriver) do(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+	d.mu.Lock()
+	d.queries = append(d.queries, query)
+	d.args = append(d.args, args)
+	d.mu.Unlock()
+	if d.handler == nil {
+		return nil, nil, nil
+	}
+	return d.handler(query, args)
+}
+
+// driver.Connector
+func (d *testDriver) Connect(ctx context.Context) (driver.Conn, error) {
+	return &testConn{drv: d}, nil
+}
+func (d *testDriver) Driver() driver.Driver {
+	return d
+}
+
+// driver.Driver, the connection is refused when the name has prefix 'refused'.
+func (d *testDriver) Open(name string) (driver.Conn, error) {
+	if strings.HasPrefix(name, "refused") {
+		return nil, errors.New("connection refused")
+	}
+	return &testConn{drv: d}, nil
+}
+
+type testConn struct {
+	drv *testDriver
+}
+
+func (c *testConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, driver.ErrSkip
+}
+func (c *testConn) Close() error {
+	return nil
+}
+func (c *testConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.TODO(), driver.TxOptions{})
+}
+func (c *testConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if _, _, err := c.drv.do("BEGIN", nil); err != nil {
+		return nil, err
+	}
+	return &testTx{conn: c}, nil
+}
+func (c *testConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if out, ok := nv.Value.(sql.Out); ok {
+		// set a value for the output argument
+		if id, ok := out.Dest.(*int64); ok {
+			*id = 1
+		}
+	}
+	return nil
+}
+func (c *testConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	_, rows, err := c.drv.do(query, args)
+	if err != nil {
+		return nil, err
+	}
+	affected := int64(1)
+	if rows != nil {
+		affected = int64(len(rows))
+	}
+	return &testResult{lastId: 1, affected: affected}, nil
+}
+func (c *testConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	columns, rows, err := c.drv.do(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &testRows{columns: columns, rows: rows}, nil
+}
+
+type testTx struct {
+	conn *testConn
+}
+
+func (t *testTx) Commit() error {
+	_, _, err := t.conn.drv.do("COMMIT", nil)
+	return err
+}
+func (t *testTx) Rollback() error {
+	_, _, err := t.conn.drv.do("ROLLBACK", nil)
+	return err
+}
+
+type testRows struct {
+	columns []string
+	rows    [][]driver.Value
+	idx     int
+}
+
+func (r *testRows) Columns() []string {
+	return r.columns
+}
+func (r *testRows) Close() error {
+	return nil
+}
+func (r *testRows) Next(dest []driver.Value) error {
+	if r.idx >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.idx])
+	r.idx++
+	return nil
+}
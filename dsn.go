@@ -0,0 +1,187 @@
+package database
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gwaylib/errors"
+)
+
+const redactedPassword = "***"
+
+var (
+	// password=xxx, pwd=xxx of the key-value dsn, like postgres, sqlserver and oracle.
+	dsnKVPassword = regexp.MustCompile(`(?i)(^|[\s;])(password|pwd)(\s*=\s*)("(?:[^"]|"")*"|'(?:[^'\\]|\\.)*'|[^\s;]*)`)
+	// _auth_pass=xxx of sqlite3
+	dsnSqlitePassword = regexp.MustCompile(`([?&]_auth_pass=)([^&]*)`)
+
+	// the builtin driver families, matched by the contained name in order.
+	driverFamilies = []struct {
+		name   string
+		family string
+	}{
+		{"oracle", DRV_NAME_ORACLE}, {"oci8", DRV_NAME_ORACLE}, {"godror", DRV_NAME_ORACLE},
+		{"postgres", DRV_NAME_POSTGRES}, {"pgx", DRV_NAME_POSTGRES},
+		{"sqlserver", DRV_NAME_SQLSERVER}, {"mssql", DRV_NAME_SQLSERVER},
+		{"mysql", DRV_NAME_MYSQL},
+		{"sqlite3", DRV_NAME_SQLITE3},
+	}
+)
+
+// return the builtin driver name of drvName, or empty if unknown.
+func driverFamily(drvName string) string {
+	for _, f := range driverFamilies {
+		if strings.Index(drvName, f.name) > -1 {
+			return f.family
+		}
+	}
+	return ""
+}
+
+// Set the password of dsn by the format of driver.
+func setDSNPassword(drvName, dsn, password string) (string, error) {
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err != nil || u.User == nil {
+			return "", errors.New("unsupport dsn to set password").As(drvName)
+		}
+		u.User = url.UserPassword(u.User.Username(), password)
+		return u.String(), nil
+	}
+
+	switch driverFamily(drvName) {
+	case DRV_NAME_MYSQL:
+		// [username[:password]@][protocol[(address)]]/dbname[?param1=value1]
+		at := mysqlUserIndex(dsn)
+		if at < 0 {
+			return "", errors.New("unsupport dsn to set password").As(drvName)
+		}
+		user := dsn[:at]
+		if i := strings.Index(user, ":"); i > -1 {
+			user = user[:i]
+		}
+		return user + ":" + password + dsn[at:], nil
+	case DRV_NAME_SQLITE3:
+		// remove the old one first, and keep the '?' when it is the first param.
+		dsn = dsnSqlitePassword.ReplaceAllStringFunc(dsn, func(param string) string {
+			if param[0] == '?' {
+				return "?"
+			}
+			return ""
+		})
+		dsn = strings.Replace(dsn, "?&", "?", 1)
+		sep := "?"
+		if i := strings.Index(dsn, "?"); i == len(dsn)-1 {
+			sep = ""
+		} else if i > -1 {
+			sep = "&"
+		}
+		return dsn + sep + "_auth_pass=" + url.QueryEscape(password), nil
+	case DRV_NAME_POSTGRES:
+		// host=localhost user=xxx password='xxx'
+		quoted := "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(password) + "'"
+		return setKVPassword(dsn, " ", quoted), nil
+	case DRV_NAME_SQLSERVER:
+		// server=localhost;user id=xxx;password=xxx
+		if strings.ContainsAny(password, `;"' `) {
+			password = `"` + strings.Replace(password, `"`, `""`, -1) + `"`
+		}
+		return setKVPassword(dsn, ";", password), nil
+	case DRV_NAME_ORACLE:
+		// user/password@host:port/service
+		if at := strings.LastIndex(dsn, "@"); at > -1 && !dsnKVPassword.MatchString(dsn) {
+			user := dsn[:at]
+			if i := strings.Index(user, "/"); i > -1 {
+				user = user[:i]
+			}
+			return user + "/" + password + dsn[at:], nil
+		}
+		// user="xxx" password="xxx" connectString="host:port/service"
+		return setKVPassword(dsn, " ", `"`+strings.Replace(password, `"`, `\"`, -1)+`"`), nil
+	}
+	return "", errors.New("unsupport driver to set password").As(drvName)
+}
+
+// return the index of '@' which ends the user info of mysql dsn, -1 if not found.
+func mysqlUserIndex(dsn string) int {
+	slash := strings.LastIndex(dsn, "/")
+	if slash < 0 {
+		return -1
+	}
+	return strings.LastIndex(dsn[:slash], "@")
+}
+
+// replace the password value of key-value dsn, or append a new one with sep.
+func setKVPassword(dsn, sep, value string) string {
+	replaced := false
+	result := dsnKVPassword.ReplaceAllStringFunc(dsn, func(m string) string {
+		if replaced {
+			return ""
+		}
+		replaced = true
+		sub := dsnKVPassword.FindStringSubmatch(m)
+		return sub[1] + sub[2] + sub[3] + value
+	})
+	if replaced {
+		return result
+	}
+	dsn = strings.TrimRight(dsn, sep+" ")
+	if len(dsn) == 0 {
+		return "password=" + value
+	}
+	return dsn + sep + "password=" + value
+}
+
+// Return the dsn with the password masked, it's used for the error and log.
+// If the dsn can not be parsed, all of it will be masked.
+func redactDSN(drvName, dsn string) string {
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return redactedPassword
+		}
+		if _, ok := u.User.Password(); ok {
+			// the url escapes the '*', so replace it after encoding.
+			u.User = url.UserPassword(u.User.Username(), "")
+			userinfo := "://" + u.User.String() + "@"
+			dsn = strings.Replace(u.String(), userinfo, strings.TrimSuffix(userinfo, "@")+redactedPassword+"@", 1)
+		}
+	}
+	dsn = dsnSqlitePassword.ReplaceAllString(dsn, "${1}"+redactedPassword)
+	dsn = dsnKVPassword.ReplaceAllString(dsn, "${1}${2}${3}"+redactedPassword)
+
+	switch driverFamily(drvName) {
+	case DRV_NAME_SQLITE3, DRV_NAME_POSTGRES, DRV_NAME_SQLSERVER:
+		return dsn
+	case DRV_NAME_ORACLE:
+		// user/password@host:port/service
+		if strings.Contains(dsn, "://") {
+			return dsn
+		}
+		at := strings.LastIndex(dsn, "@")
+		if at < 0 {
+			return dsn
+		}
+		if i := strings.Index(dsn[:at], "/"); i > -1 {
+			return dsn[:i+1] + redactedPassword + dsn[at:]
+		}
+		return dsn
+	default:
+		// mysql or the unknown, [username[:password]@]...
+		if strings.Contains(dsn, "://") {
+			return dsn
+		}
+		at := mysqlUserIndex(dsn)
+		if at < 0 {
+			at = strings.LastIndex(dsn, "@")
+		}
+		if at < 0 {
+			return dsn
+		}
+		if i := strings.Index(dsn[:at], ":"); i > -1 {
+			return dsn[:i+1] + redactedPassword + dsn[at:]
+		}
+		return dsn
+	}
+}
@@ -0,0 +1,361 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	stderrors "errors"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gwaylib/errors"
+)
+
+// The class of the database errors.
+type ErrorClass int
+
+const (
+	ERR_CLASS_UNKNOWN ErrorClass = iota
+	ERR_CLASS_UNIQUE_VIOLATION
+	ERR_CLASS_FOREIGN_KEY_VIOLATION
+	ERR_CLASS_NOT_NULL_VIOLATION
+	ERR_CLASS_DEADLOCK
+	ERR_CLASS_SERIALIZATION_FAILURE
+	ERR_CLASS_TIMEOUT
+	ERR_CLASS_CONNECTION
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ERR_CLASS_UNIQUE_VIOLATION:
+		return "unique_violation"
+	case ERR_CLASS_FOREIGN_KEY_VIOLATION:
+		return "foreign_key_violation"
+	case ERR_CLASS_NOT_NULL_VIOLATION:
+		return "not_null_violation"
+	case ERR_CLASS_DEADLOCK:
+		return "deadlock"
+	case ERR_CLASS_SERIALIZATION_FAILURE:
+		return "serialization_failure"
+	case ERR_CLASS_TIMEOUT:
+		return "timeout"
+	case ERR_CLASS_CONNECTION:
+		return "connection"
+	}
+	return "unknown"
+}
+
+// Return the class of the error, or ERR_CLASS_UNKNOWN if it is not known by the classifier.
+type ErrorClassifier func(err error) ErrorClass
+
+var (
+	errClassLock        = sync.RWMutex{}
+	errClassifiers      = map[string]ErrorClassifier{}
+	builtinErrorClasses = []ErrorClass{
+		ERR_CLASS_UNIQUE_VIOLATION,
+		ERR_CLASS_FOREIGN_KEY_VIOLATION,
+		ERR_CLASS_NOT_NULL_VIOLATION,
+		ERR_CLASS_DEADLOCK,
+		ERR_CLASS_SERIALIZATION_FAILURE,
+		ERR_CLASS_TIMEOUT,
+		ERR_CLASS_CONNECTION,
+	}
+)
+
+// Register an error classifier for the driver name, it will replace the old one if exists.
+// The classifier is tried before the builtin one when classifying the error of the driver,
+// and the known class of it overrides the builtin.
+func RegisterErrorClassifier(drvName string, fn ErrorClassifier) {
+	errClassLock.Lock()
+	defer errClassLock.Unlock()
+	errClassifiers[drvName] = fn
+}
+
+// return the driver name of the optional drvNames, empty if not set.
+func errDrvName(drvNames []string) string {
+	switch len(drvNames) {
+	case 0:
+		return ""
+	case 1:
+		return drvNames[0]
+	}
+	panic(errors.New("'drvNames' expect only one argument").As(drvNames))
+}
+
+// return the class by the registered classifier of driver.
+func registeredErrorClass(drvName string, err error) ErrorClass {
+	errClassLock.RLock()
+	fn, ok := errClassifiers[drvName]
+	errClassLock.RUnlock()
+	if !ok {
+		return ERR_CLASS_UNKNOWN
+	}
+	return fn(err)
+}
+
+// Return the class of error by the registered classifier of the driver and the builtin one,
+// it is ERR_CLASS_UNKNOWN if err is nil or not known.
+// The registered classifier is tried first when the drvNames is set, and then the builtin one.
+func ClassifyError(err error, drvNames ...string) ErrorClass {
+	if err == nil {
+		return ERR_CLASS_UNKNOWN
+	}
+	if class := registeredErrorClass(errDrvName(drvNames), err); class != ERR_CLASS_UNKNOWN {
+		return class
+	}
+	for _, class := range builtinErrorClasses {
+		if builtinErrorClass(err, class) {
+			return class
+		}
+	}
+	return ERR_CLASS_UNKNOWN
+}
+
+// Return the class of error by the registered classifier of the db driver and the builtin one.
+func (db *DB) ClassifyError(err error) ErrorClass {
+	return ClassifyError(err, db.driverName)
+}
+
+// return true if the error is the class, an error may be matched by several classes of builtin,
+// such as the lock wait timeout of mysql is a deadlock and a timeout.
+func isErrorClass(drvName string, err error, class ErrorClass) bool {
+	if err == nil {
+		return false
+	}
+	if c := registeredErrorClass(drvName, err); c != ERR_CLASS_UNKNOWN {
+		return c == class
+	}
+	return builtinErrorClass(err, class)
+}
+
+// Return true if the error is a violation of unique or primary key constraint,
+// the drvNames is optional for using the registered classifier of driver.
+func IsUniqueViolation(err error, drvNames ...string) bool {
+	return isErrorClass(errDrvName(drvNames), err, ERR_CLASS_UNIQUE_VIOLATION)
+}
+
+// Return true if the error is a violation of foreign key constraint.
+func IsForeignKeyViolation(err error, drvNames ...string) bool {
+	return isErrorClass(errDrvName(drvNames), err, ERR_CLASS_FOREIGN_KEY_VIOLATION)
+}
+
+// Return true if the error is a violation of not null constraint.
+func IsNotNullViolation(err error, drvNames ...string) bool {
+	return isErrorClass(errDrvName(drvNames), err, ERR_CLASS_NOT_NULL_VIOLATION)
+}
+
+// Return true if the error is a deadlock or lock conflict, the transaction can be retried.
+func IsDeadlock(err error, drvNames ...string) bool {
+	return isErrorClass(errDrvName(drvNames), err, ERR_CLASS_DEADLOCK)
+}
+
+// Return true if the error is a serialization failure, the transaction can be retried.
+func IsSerializationFailure(err error, drvNames ...string) bool {
+	return isErrorClass(errDrvName(drvNames), err, ERR_CLASS_SERIALIZATION_FAILURE)
+}
+
+// Return true if the error is a timeout of context, network or statement.
+func IsTimeout(err error, drvNames ...string) bool {
+	return isErrorClass(errDrvName(drvNames), err, ERR_CLASS_TIMEOUT)
+}
+
+// Return true if the error is a failure of connecting or a broken connection.
+func IsConnectionError(err error, drvNames ...string) bool {
+	return isErrorClass(errDrvName(drvNames), err, ERR_CLASS_CONNECTION)
+}
+
+// the errors.Error of gwaylib, it is embedded as a named field.
+type gwaylibError = errors.Error
+
+// The error wrapped by the gwaylib/errors with the original error of driver,
+// so the typed error of driver can be got by errors.As of the standard library, and classified by its type.
+// It implements the errors.Error of gwaylib by the wrapped one, and the As of it returns the wrapped without the cause.
+type causeError struct {
+	gwaylibError
+	cause error
+}
+
+func (e *causeError) Unwrap() error {
+	return e.cause
+}
+
+// keep the original error in the wrapped one, the gwaylib/errors keeps the message only.
+func withCause(wrapped errors.Error, err error) error {
+	if wrapped == nil {
+		return nil
+	}
+	if c, ok := err.(*causeError); ok {
+		err = c.cause
+	}
+	return &causeError{gwaylibError: wrapped, cause: err}
+}
+
+// the builtin rules of a class.
+type errorRule struct {
+	// the prefix of SQLSTATE, from the SQLState() of postgres drivers or the '(SQLSTATE xxxxx)' of message.
+	sqlStates []string
+	// the SQLErrorNumber() of sqlserver driver.
+	mssqlNumbers []int32
+	// the parts of message, the mysql and oracle errors are matched by the codes in message.
+	messages []string
+}
+
+var errorRules = map[ErrorClass]errorRule{
+	ERR_CLASS_UNIQUE_VIOLATION: {
+		sqlStates:    []string{"23505"},
+		mssqlNumbers: []int32{2601, 2627},
+		messages: []string{
+			// mysql
+			"Error 1062", "Error 1586", "Duplicate entry",
+			// postgres
+			"duplicate key value violates unique constraint",
+			// sqlite3
+			"UNIQUE constraint failed",
+			// sqlserver
+			"Violation of PRIMARY KEY constraint", "Violation of UNIQUE KEY constraint", "Cannot insert duplicate key",
+			// oracle
+			"ORA-00001",
+		},
+	},
+	ERR_CLASS_FOREIGN_KEY_VIOLATION: {
+		sqlStates: []string{"23503"},
+		messages: []string{
+			// mysql
+			"Error 1216", "Error 1217", "Error 1451", "Error 1452",
+			// postgres
+			"violates foreign key constraint",
+			// sqlite3
+			"FOREIGN KEY constraint failed",
+			// sqlserver, the number 547 is used by the check constraint too.
+			"conflicted with the FOREIGN KEY constraint", "conflicted with the REFERENCE constraint",
+			// oracle
+			"ORA-02291", "ORA-02292",
+		},
+	},
+	ERR_CLASS_NOT_NULL_VIOLATION: {
+		sqlStates:    []string{"23502"},
+		mssqlNumbers: []int32{515},
+		messages: []string{
+			// mysql
+			"Error 1048", "Error 1364",
+			// postgres
+			"violates not-null constraint",
+			// sqlite3
+			"NOT NULL constraint failed",
+			// sqlserver
+			"Cannot insert the value NULL",
+			// oracle
+			"ORA-01400",
+		},
+	},
+	ERR_CLASS_DEADLOCK: {
+		sqlStates:    []string{"40P01"},
+		mssqlNumbers: []int32{1205},
+		messages: []string{
+			// mysql, 1205 is the lock wait timeout.
+			"Error 1213", "Error 1205",
+			// postgres
+			"deadlock detected",
+			// sqlite3
+			"database is locked", "database table is locked",
+			// sqlserver
+			"was deadlocked",
+			// oracle
+			"ORA-00060",
+		},
+	},
+	ERR_CLASS_SERIALIZATION_FAILURE: {
+		sqlStates:    []string{"40001"},
+		mssqlNumbers: []int32{3960},
+		messages: []string{
+			// postgres
+			"could not serialize access",
+			// sqlserver
+			"Snapshot isolation transaction aborted due to update conflict",
+			// oracle
+			"ORA-08177",
+		},
+	},
+	ERR_CLASS_TIMEOUT: {
+		sqlStates: []string{"57014"},
+		messages: []string{
+			context.DeadlineExceeded.Error(), "i/o timeout",
+			// mysql
+			"Error 1205", "Error 3024",
+			// postgres
+			"canceling statement due to statement timeout",
+			// oracle
+			"ORA-01013", "ORA-12170",
+		},
+	},
+	ERR_CLASS_CONNECTION: {
+		sqlStates: []string{"08"},
+		messages: []string{
+			driver.ErrBadConn.Error(), "connection refused", "connection reset", "broken pipe", "no such host",
+			// mysql
+			"invalid connection", "Error 2002", "Error 2003", "Error 2006", "Error 2013",
+			// sqlite3
+			"unable to open database file",
+			// sqlserver
+			"unable to open tcp connection",
+			// oracle
+			"ORA-03113", "ORA-03114", "ORA-12541", "ORA-12514",
+		},
+	},
+}
+
+// the SQLSTATE in the message of pgx.
+var errSQLState = regexp.MustCompile(`SQLSTATE ([0-9A-Z]{5})`)
+
+// return the SQLSTATE of error, empty if not found.
+func errorSQLState(err error) string {
+	var stater interface{ SQLState() string }
+	if stderrors.As(err, &stater) {
+		return stater.SQLState()
+	}
+	if m := errSQLState.FindStringSubmatch(err.Error()); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+func builtinErrorClass(err error, class ErrorClass) bool {
+	switch class {
+	case ERR_CLASS_TIMEOUT:
+		var netErr net.Error
+		if stderrors.Is(err, context.DeadlineExceeded) || (stderrors.As(err, &netErr) && netErr.Timeout()) {
+			return true
+		}
+	case ERR_CLASS_CONNECTION:
+		var opErr *net.OpError
+		if stderrors.Is(err, driver.ErrBadConn) || (stderrors.As(err, &opErr) && !opErr.Timeout()) {
+			return true
+		}
+	}
+
+	rule := errorRules[class]
+	if state := errorSQLState(err); state != "" {
+		for _, prefix := range rule.sqlStates {
+			if strings.HasPrefix(state, prefix) {
+				return true
+			}
+		}
+	}
+	var numberer interface{ SQLErrorNumber() int32 }
+	if stderrors.As(err, &numberer) {
+		number := numberer.SQLErrorNumber()
+		for _, n := range rule.mssqlNumbers {
+			if n == number {
+				return true
+			}
+		}
+	}
+	msg := err.Error()
+	for _, m := range rule.messages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	stderrors "errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/gwaylib/errors"
+)
+
+// a typed error of postgres driver
+type testPgError struct {
+	code string
+}
+
+func (e *testPgError) Error() string    { return "pq: some error" }
+func (e *testPgError) SQLState() string { return e.code }
+
+// a typed error of sqlserver driver
+type testMssqlError struct {
+	number int32
+}
+
+func (e *testMssqlError) Error() string         { return "mssql: some error" }
+func (e *testMssqlError) SQLErrorNumber() int32 { return e.number }
+
+func TestClassifyError(t *testing.T) {
+	for _, c := range []struct {
+		err   error
+		class ErrorClass
+	}{
+		{nil, ERR_CLASS_UNKNOWN},
+		{fmt.Errorf("testing"), ERR_CLASS_UNKNOWN},
+		{fmt.Errorf("Error 1062 (23000): Duplicate entry 'a' for key 'name'"), ERR_CLASS_UNIQUE_VIOLATION},
+		{fmt.Errorf("UNIQUE constraint failed: testing.name"), ERR_CLASS_UNIQUE_VIOLATION},
+		{fmt.Errorf("ERROR: duplicate key value violates unique constraint \"name\" (SQLSTATE 23505)"), ERR_CLASS_UNIQUE_VIOLATION},
+		{&testPgError{"23505"}, ERR_CLASS_UNIQUE_VIOLATION},
+		{&testMssqlError{2627}, ERR_CLASS_UNIQUE_VIOLATION},
+		{fmt.Errorf("ORA-00001: unique constraint violated"), ERR_CLASS_UNIQUE_VIOLATION},
+		{&testPgError{"23503"}, ERR_CLASS_FOREIGN_KEY_VIOLATION},
+		{fmt.Errorf("FOREIGN KEY constraint failed"), ERR_CLASS_FOREIGN_KEY_VIOLATION},
+		{fmt.Errorf("Error 1048: Column 'name' cannot be null"), ERR_CLASS_NOT_NULL_VIOLATION},
+		{&testMssqlError{515}, ERR_CLASS_NOT_NULL_VIOLATION},
+		{fmt.Errorf("Error 1213: Deadlock found when trying to get lock"), ERR_CLASS_DEADLOCK},
+		{&testPgError{"40P01"}, ERR_CLASS_DEADLOCK},
+		{&testPgError{"40001"}, ERR_CLASS_SERIALIZATION_FAILURE},
+		{fmt.Errorf("ORA-08177: can't serialize access for this transaction"), ERR_CLASS_SERIALIZATION_FAILURE},
+		{context.DeadlineExceeded, ERR_CLASS_TIMEOUT},
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), ERR_CLASS_TIMEOUT},
+		{&testPgError{"57014"}, ERR_CLASS_TIMEOUT},
+		{driver.ErrBadConn, ERR_CLASS_CONNECTION},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("connect: connection refused")}, ERR_CLASS_CONNECTION},
+		{&testPgError{"08006"}, ERR_CLASS_CONNECTION},
+	} {
+		if class := ClassifyError(c.err); class != c.class {
+			t.Fatal(c.err, class)
+		}
+		// the wrapped by the package keeps the original error.
+		if c.err != nil {
+			wrapped := withCause(errors.As(c.err, "wrapped"), c.err)
+			wrapped = withCause(errors.As(wrapped, "wrapped again"), wrapped)
+			if class := ClassifyError(wrapped); class != c.class {
+				t.Fatal(c.err, class)
+			}
+		}
+	}
+
+	// the mysql lock wait timeout is a deadlock and a timeout.
+	err := fmt.Errorf("Error 1205: Lock wait timeout exceeded; try restarting transaction")
+	if !IsDeadlock(err) || !IsTimeout(err) || IsUniqueViolation(err) {
+		t.Fatal(err)
+	}
+	if IsConnectionError(nil) {
+		t.Fatal("expect false")
+	}
+}
+
+func TestRegisterErrorClassifier(t *testing.T) {
+	errCustom := fmt.Errorf("custom: code 42")
+	if ClassifyError(errCustom) != ERR_CLASS_UNKNOWN {
+		t.Fatal("expect unknown")
+	}
+	// the conflicting classifiers of two drivers
+	classifier := func(class ErrorClass) ErrorClassifier {
+		return func(err error) ErrorClass {
+			if strings.Contains(err.Error(), "custom: code 42") {
+				return class
+			}
+			return ERR_CLASS_UNKNOWN
+		}
+	}
+	RegisterErrorClassifier("testclassifier1", classifier(ERR_CLASS_SERIALIZATION_FAILURE))
+	RegisterErrorClassifier("testclassifier2", classifier(ERR_CLASS_UNIQUE_VIOLATION))
+	defer RegisterErrorClassifier("testclassifier1", classifier(ERR_CLASS_UNKNOWN))
+	defer RegisterErrorClassifier("testclassifier2", classifier(ERR_CLASS_UNKNOWN))
+
+	if !IsSerializationFailure(errCustom, "testclassifier1") || IsUniqueViolation(errCustom, "testclassifier1") {
+		t.Fatal(ClassifyError(errCustom, "testclassifier1"))
+	}
+	if !IsUniqueViolation(errCustom, "testclassifier2") || IsSerializationFailure(errCustom, "testclassifier2") {
+		t.Fatal(ClassifyError(errCustom, "testclassifier2"))
+	}
+	if ClassifyError(errCustom) != ERR_CLASS_UNKNOWN {
+		t.Fatal("expect unknown without driver")
+	}
+	// retry by the default retry classifier of driver
+	if !getRetryClassifier("testclassifier1")(errCustom) || getRetryClassifier("testclassifier2")(errCustom) {
+		t.Fatal("expect retryable by testclassifier1 only")
+	}
+}
+
+func TestClassifyWrappedError(t *testing.T) {
+	db, _ := newTestDB("testclassifier3", func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		return nil, nil, &testPgError{"23505"}
+	})
+	defer Close(db)
+	RegisterErrorClassifier("testclassifier3", func(err error) ErrorClass {
+		var pgErr *testPgError
+		if stderrors.As(err, &pgErr) && pgErr.code == "23505" {
+			return ERR_CLASS_DEADLOCK
+		}
+		return ERR_CLASS_UNKNOWN
+	})
+	defer RegisterErrorClassifier("testclassifier3", func(err error) ErrorClass { return ERR_CLASS_UNKNOWN })
+
+	_, err := InsertStruct(db, &ReflectTestStruct6{Name: "a"}, "testing")
+	var pgErr *testPgError
+	if !stderrors.As(err, &pgErr) || !IsUniqueViolation(err) || db.ClassifyError(err) != ERR_CLASS_DEADLOCK {
+		t.Fatal(err)
+	}
+	// it is still an errors.Error of gwaylib
+	if gErr, ok := err.(errors.Error); !ok || gErr.Code() != pgErr.Error() || !gErr.Equal(pgErr) {
+		t.Fatal(err)
+	}
+}
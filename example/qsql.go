@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/gwaylib/database"
@@ -106,24 +107,19 @@ func main() {
 	fmt.Printf("PageMap data: %+v\n", mData)
 
 	// executer for tx
-	tx, err := mdb.Begin()
-	if err != nil {
-		panic(err)
-	}
 	txUsers := []TestingUser{
 		{UserName: "t3", Passwd: "t3"},
 		{UserName: "t4", Passwd: "t4"},
 	}
-	for _, u := range txUsers {
-		if _, err := database.InsertStruct(tx, &u, "user"); err != nil {
-			println(errors.As(err))
-			database.Rollback(tx)
-			return
+	if err := mdb.WithTx(context.TODO(), nil, func(tx *database.Tx) error {
+		for _, u := range txUsers {
+			if _, err := database.InsertStruct(tx, &u, "user"); err != nil {
+				return errors.As(err)
+			}
 		}
-	}
-	if err := tx.Commit(); err != nil {
+		return nil
+	}); err != nil {
 		println(errors.As(err))
-		database.Rollback(tx)
 		return
 	}
 
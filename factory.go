@@ -1,96 +1,428 @@
 package database
 
 import (
-	"os"
+	"context"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/go-ini/ini"
 	"github.com/gwaylib/errors"
 )
 
+// The key of a db in the Registry.
+type CacheKey struct {
+	Source  string // the source of config, such as the file name.
+	Section string
+}
+
+func (k CacheKey) String() string {
+	return k.Source + "[" + k.Section + "]"
+}
+
 var (
-	cacheLock = sync.Mutex{}
-	cache     = map[string]*DB{}
+	// the registry is closing by CloseContext, the lookup will be failed.
+	ErrCacheClosing = errors.New("cache is closing")
 )
 
-func regCache(iniFileName, sectionName string, db *DB) {
-	cacheLock.Lock()
-	defer cacheLock.Unlock()
-	key := iniFileName + sectionName
-	cache[key] = db
+// The registry of the opened dbs, a db of section is opened once and cached by the key of config source and section.
+// The package functions like GetCache are using a default registry, and the independent one can be made by NewRegistry.
+type Registry struct {
+	// the version of cached dbs, it is increased when a db is added, swapped or removed.
+	version uint64
+
+	mu      sync.Mutex
+	dbs     map[CacheKey]*DB
+	opening map[CacheKey]*openCall
+	closing bool
+
+	onRegister func(key CacheKey, db *DB)
+	onClose    func(key CacheKey, db *DB, err error)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{dbs: map[CacheKey]*DB{}, opening: map[CacheKey]*openCall{}}
+}
+
+var defaultRegistry = NewRegistry()
+
+// Return the registry used by the package functions.
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// Set a hook to observe the db registered, it is called when the db is registered, opened or swapped in by reloading.
+func (r *Registry) OnRegister(fn func(key CacheKey, db *DB)) *Registry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onRegister = fn
+	return r
+}
+
+// Set a hook to observe the db of registry closed, err is the error of closing.
+func (r *Registry) OnClose(fn func(key CacheKey, db *DB, err error)) *Registry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onClose = fn
+	return r
+}
+
+func (r *Registry) notifyRegister(key CacheKey, db *DB) {
+	r.mu.Lock()
+	fn := r.onRegister
+	r.mu.Unlock()
+	if fn != nil {
+		fn(key, db)
+	}
+}
+
+func (r *Registry) notifyClose(key CacheKey, db *DB, err error) {
+	r.mu.Lock()
+	fn := r.onClose
+	r.mu.Unlock()
+	if fn != nil {
+		fn(key, db, err)
+	}
+}
+
+// bind the db to the registry, so it can be removed from the registry when closing.
+func (r *Registry) bind(key CacheKey, db *DB) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.registry = r
+	db.key = key
+}
+
+// Register a db by manully, it will replace the old one of key.
+func (r *Registry) Register(key CacheKey, db *DB) {
+	r.bind(key, db)
+	r.mu.Lock()
+	r.dbs[key] = db
+	r.changed()
+	r.mu.Unlock()
+	r.notifyRegister(key, db)
 }
 
-func getCache(iniFileName, sectionName string) (*DB, error) {
-	cacheLock.Lock()
-	defer cacheLock.Unlock()
+// Return the cached db of key.
+func (r *Registry) Lookup(key CacheKey) (*DB, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	db, ok := r.dbs[key]
+	return db, ok
+}
 
-	key := iniFileName + sectionName
+// Return the keys of cached dbs in order.
+func (r *Registry) List() []CacheKey {
+	r.mu.Lock()
+	keys := make([]CacheKey, 0, len(r.dbs))
+	for key := range r.dbs {
+		keys = append(keys, key)
+	}
+	r.mu.Unlock()
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Source != keys[j].Source {
+			return keys[i].Source < keys[j].Source
+		}
+		return keys[i].Section < keys[j].Section
+	})
+	return keys
+}
+
+// Remove the db of key from the registry and close it, return false if the key is not found.
+func (r *Registry) Remove(key CacheKey) bool {
+	r.mu.Lock()
+	db, ok := r.dbs[key]
+	delete(r.dbs, key)
+	r.changed()
+	r.mu.Unlock()
+	if ok {
+		Close(db)
+	}
+	return ok
+}
+
+// Get the db from the registry, or open a new one by the config of loader.
+func (r *Registry) Get(loader ConfigLoader, sectionName string) (*DB, error) {
+	return r.get(context.TODO(), loader, sectionName, false)
+}
+
+// Get the db from the registry, or open a new one by the config of loader and ping it with ctx.
+func (r *Registry) GetContext(ctx context.Context, loader ConfigLoader, sectionName string) (*DB, error) {
+	return r.get(ctx, loader, sectionName, true)
+}
+
+// the in-flight open of a key, the concurrent lookups of the key wait the done.
+type openCall struct {
+	done chan struct{}
+	db   *DB
+	err  error
+}
+
+// get the db from cache, or open a new one by the config of loader,
+// the new one is pinged with ctx when ping is true or the PingOnOpen of config is set.
+// The concurrent lookups of a key share one open, and the lock is not held during opening,
+// so the lookups of the other keys are not blocked.
+func (r *Registry) get(ctx context.Context, loader ConfigLoader, sectionName string, ping bool) (*DB, error) {
+	key := CacheKey{Source: loader.Source(), Section: sectionName}
+
+	r.mu.Lock()
+	if r.closing {
+		r.mu.Unlock()
+		return nil, ErrCacheClosing.As(key)
+	}
 
 	// get from cache
-	db, ok := cache[key]
+	db, ok := r.dbs[key]
 	if ok {
+		r.mu.Unlock()
 		return db, nil
 	}
 
-	// create a new
-	cfg, err := ini.Load(iniFileName)
-	if err != nil {
-		return nil, errors.As(err, iniFileName)
+	// wait the in-flight open
+	if call, ok := r.opening[key]; ok {
+		r.mu.Unlock()
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, errors.As(ctx.Err(), key)
+		}
+		if call.err != nil {
+			return nil, errors.As(call.err)
+		}
+		return call.db, nil
 	}
-	section, err := cfg.GetSection(sectionName)
-	if err != nil {
-		return nil, errors.As(err, sectionName)
+	call := &openCall{done: make(chan struct{})}
+	r.opening[key] = call
+	r.mu.Unlock()
+
+	// create a new
+	db, err := r.open(ctx, loader, key, ping)
+
+	r.mu.Lock()
+	delete(r.opening, key)
+	registered := false
+	if err == nil {
+		if cached, ok := r.dbs[key]; ok {
+			// registered by manully during opening.
+			db.DB.Close()
+			db = cached
+		} else if r.closing {
+			db.DB.Close()
+			db, err = nil, ErrCacheClosing.As(key)
+		} else {
+			r.bind(key, db)
+			r.dbs[key] = db
+			r.changed()
+			registered = true
+		}
 	}
-	drvName, err := section.GetKey("driver")
+	r.mu.Unlock()
+	call.db, call.err = db, err
+	close(call.done)
+
 	if err != nil {
-		return nil, errors.As(err, "not found 'driver'")
+		return nil, err
 	}
-	dsn, err := section.GetKey("dsn")
-	if err != nil {
-		return nil, errors.As(err, "not found 'dsn'")
+	if registered {
+		r.notifyRegister(key, db)
 	}
-	// http://techblog.en.klab-blogs.com/archives/31093990.html
-	lifeTimeKey, err := section.GetKey("life_time")
+	return db, nil
+}
+
+func (r *Registry) open(ctx context.Context, loader ConfigLoader, key CacheKey, ping bool) (*DB, error) {
+	cfg, err := loader.Load(key.Section)
 	if err != nil {
-		// ignore error, and make default value
-		lifeTimeKey, err = section.NewKey("life_time", "0")
-		if err != nil {
-			return nil, errors.As(err)
-		}
+		return nil, errors.As(err)
 	}
-	lifeTime, err := lifeTimeKey.Int64()
+	db, err := openConfigDsn(ctx, cfg, 0, ping || cfg.PingOnOpen)
 	if err != nil {
-		return nil, errors.As(err, "error life_time value")
+		return nil, errors.As(err, key)
 	}
+	return db, nil
+}
+
+// open the db and set the pool by the config.
+func openConfig(c *Config) (*DB, error) {
+	return openConfigDsn(context.TODO(), c, 0, c.PingOnOpen)
+}
 
-	db, err = Open(drvName.String(), os.ExpandEnv(dsn.String()))
+// open the db with the dsn of index, 0 is the Dsn, and the others are the FallbackDsns.
+// The db is pinged with ctx and the ConnectTimeout of config when ping is true.
+func openConfigDsn(ctx context.Context, c *Config, dsnIdx int, ping bool) (*DB, error) {
+	dsn := c.Dsn
+	if dsnIdx > 0 {
+		dsn = c.FallbackDsns[dsnIdx-1]
+	}
+	db, err := Open(c.DriverName, dsn)
 	if err != nil {
 		return nil, errors.As(err)
 	}
-	if lifeTime > 0 {
-		db.SetConnMaxLifetime(time.Duration(lifeTime) * time.Second)
+	db.cfg = c
+	db.dsnIdx = dsnIdx
+	if c.LifeTime > 0 {
+		db.SetConnMaxLifetime(c.LifeTime)
+	}
+	if c.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(c.MaxOpenConns)
+	}
+	if c.MaxIdleConns >= 0 {
+		db.SetMaxIdleConns(c.MaxIdleConns)
+	}
+	if c.MaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(c.MaxIdleTime)
+	}
+	if c.SlowThreshold > 0 {
+		db.slowHook = NewSlowQueryHook(c.SlowThreshold, c.SlowLogRate)
+		db.AddHook(db.slowHook)
+	}
+	if ping {
+		if c.ConnectTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, c.ConnectTimeout)
+			defer cancel()
+		}
+		if err := db.PingContext(ctx); err != nil {
+			// close the sql.DB only, it is not in the cache.
+			db.DB.Close()
+			return nil, errors.As(err, "ping")
+		}
 	}
-	cache[key] = db
 	return db, nil
 }
 
-func rmCache(src *DB) {
-	cacheLock.Lock()
-	defer cacheLock.Unlock()
-	for key, db := range cache {
-		if src == db {
-			delete(cache, key)
-			return
-		}
+// increase the version of cached dbs, it is called with the lock held.
+func (r *Registry) changed() {
+	atomic.AddUint64(&r.version, 1)
+}
+
+// return the version of cached dbs.
+func (r *Registry) cacheVersion() uint64 {
+	return atomic.LoadUint64(&r.version)
+}
+
+// return the copy of the cached dbs.
+func (r *Registry) snapshot() map[CacheKey]*DB {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	dbs := make(map[CacheKey]*DB, len(r.dbs))
+	for key, db := range r.dbs {
+		dbs[key] = db
 	}
+	return dbs
 }
 
-func closeCache() {
-	cacheLock.Lock()
-	defer cacheLock.Unlock()
-	for key, db := range cache {
+// replace the old db of key with the new one, return false if the old one is not in the cache.
+func (r *Registry) swap(key CacheKey, oldDB, newDB *DB) bool {
+	r.mu.Lock()
+	if r.dbs[key] != oldDB {
+		r.mu.Unlock()
+		return false
+	}
+	r.bind(key, newDB)
+	r.dbs[key] = newDB
+	r.changed()
+	r.mu.Unlock()
+
+	r.notifyRegister(key, newDB)
+	return true
+}
+
+// remove the db from registry if it is still the one of key.
+func (r *Registry) remove(key CacheKey, db *DB) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.dbs[key] == db {
+		delete(r.dbs, key)
+		r.changed()
+	}
+}
+
+// Close all the dbs in the registry.
+func (r *Registry) Close() {
+	r.mu.Lock()
+	dbs := r.dbs
+	r.dbs = map[CacheKey]*DB{}
+	r.changed()
+	r.mu.Unlock()
+
+	// close out of the lock, the Close of DB removes itself from the registry.
+	for _, db := range dbs {
 		Close(db)
-		delete(cache, key)
+	}
+}
+
+// The errors of closing the cached dbs.
+type CloseCacheError struct {
+	Errs map[CacheKey]error
+}
+
+func (e *CloseCacheError) Error() string {
+	msgs := make([]string, 0, len(e.Errs))
+	for key, err := range e.Errs {
+		msgs = append(msgs, key.String()+": "+err.Error())
+	}
+	sort.Strings(msgs)
+	return "close cache: " + strings.Join(msgs, "; ")
+}
+
+// the interval to check the in-use connections when draining.
+const drainInterval = 10 * time.Millisecond
+
+// Close all the dbs in the registry gracefully, the lookup is failed with ErrCacheClosing until it returns.
+// It waits the in-use connections returned until ctx is done, and then closes the dbs,
+// the errors of closing are returned by a *CloseCacheError.
+func (r *Registry) CloseContext(ctx context.Context) error {
+	r.mu.Lock()
+	r.closing = true
+	dbs := r.dbs
+	r.dbs = map[CacheKey]*DB{}
+	r.changed()
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		r.closing = false
+		r.mu.Unlock()
+	}()
+
+	errs := map[CacheKey]error{}
+	var errsLock sync.Mutex
+	wg := sync.WaitGroup{}
+	for key, db := range dbs {
+		wg.Add(1)
+		go func(key CacheKey, db *DB) {
+			defer wg.Done()
+			err := drainDB(ctx, db)
+			if closeErr := db.Close(); closeErr != nil {
+				err = errors.As(closeErr)
+			}
+			if err != nil {
+				errsLock.Lock()
+				errs[key] = err
+				errsLock.Unlock()
+			}
+		}(key, db)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return &CloseCacheError{Errs: errs}
+	}
+	return nil
+}
+
+// wait the in-use connections of db returned until ctx is done.
+func drainDB(ctx context.Context, db *DB) error {
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
+	for {
+		inUse := db.Stats().InUse
+		if inUse == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return errors.As(ctx.Err(), inUse)
+		case <-ticker.C:
+		}
 	}
 }
@@ -0,0 +1,442 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func writeTestIni(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "database")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	fileName := filepath.Join(dir, "db.cfg")
+	if err := ioutil.WriteFile(fileName, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func TestLoadIniConfig(t *testing.T) {
+	fileName := writeTestIni(t, `
+[default]
+driver: testdb
+max_open_conns: 10
+max_idle_time: 1m
+ping_on_open: true
+
+[master]
+dsn: master
+life_time: 7200
+max_idle_conns: 0
+
+[log]
+dsn: log
+max_open_conns: 20
+connect_timeout: 3
+
+[error]
+dsn: error
+max_idle_conns: abc
+`)
+	cfg, err := NewIniLoader(fileName).Load("master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DriverName != "testdb" || cfg.Dsn != "master" || cfg.LifeTime != 7200*time.Second ||
+		cfg.MaxOpenConns != 10 || cfg.MaxIdleConns != 0 || cfg.MaxIdleTime != time.Minute || !cfg.PingOnOpen {
+		t.Fatalf("%+v", cfg)
+	}
+	cfg, err = NewIniLoader(fileName).Load("log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MaxOpenConns != 20 || cfg.MaxIdleConns != -1 || cfg.ConnectTimeout != 3*time.Second {
+		t.Fatalf("%+v", cfg)
+	}
+
+	_, err = NewIniLoader(fileName).Load("error")
+	if err == nil {
+		t.Fatal("expect error")
+	}
+	if !strings.Contains(err.Error(), "max_idle_conns") || !strings.Contains(err.Error(), fileName) {
+		t.Fatal(err)
+	}
+
+	db, err := HasCache(fileName, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if db.Stats().MaxOpenConnections != 10 {
+		t.Fatal(db.Stats().MaxOpenConnections)
+	}
+}
+
+func TestConfigLoader(t *testing.T) {
+	jsonFile := writeTestIni(t, `{"default": {"driver": "testdb", "max_open_conns": 1000000}, "master": {"dsn": "master", "life_time": 2592000}}`)
+	yamlFile := writeTestIni(t, `
+default:
+  driver: testdb
+  max_open_conns: 1e+06
+master:
+  dsn: master
+  life_time: 2592000
+`)
+	tomlFile := writeTestIni(t, `
+[default]
+driver = "testdb"
+max_open_conns = 1000000
+[master]
+dsn = "master"
+life_time = 2592000
+`)
+	os.Setenv("TESTDB_DEFAULT_DRIVER", "testdb")
+	os.Setenv("TESTDB_DEFAULT_MAX_OPEN_CONNS", "1000000")
+	os.Setenv("TESTDB_MASTER_DSN", "master")
+	os.Setenv("TESTDB_MASTER_LIFE_TIME", "2592000")
+	defer func() {
+		for _, key := range []string{"TESTDB_DEFAULT_DRIVER", "TESTDB_DEFAULT_MAX_OPEN_CONNS", "TESTDB_MASTER_DSN", "TESTDB_MASTER_LIFE_TIME"} {
+			os.Unsetenv(key)
+		}
+	}()
+
+	for _, loader := range []ConfigLoader{
+		NewJSONLoader(jsonFile),
+		NewYAMLLoader(yamlFile),
+		NewTOMLLoader(tomlFile),
+		NewEnvLoader("testdb"),
+	} {
+		cfg, err := loader.Load("master")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.DriverName != "testdb" || cfg.Dsn != "master" || cfg.LifeTime != 2592000*time.Second || cfg.MaxOpenConns != 1000000 {
+			t.Fatalf("%s: %+v", loader.Source(), cfg)
+		}
+		if _, err := loader.Load("log"); err == nil {
+			t.Fatalf("%s: expect error", loader.Source())
+		}
+	}
+
+	db := GetCacheFrom(NewEnvLoader("testdb"), "master")
+	defer db.Close()
+	if db != GetCacheFrom(NewEnvLoader("testdb"), "master") {
+		t.Fatal("expect cached")
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	fileName := writeTestIni(t, `
+[master]
+driver: testdb
+dsn: master
+`)
+	oldDB, err := HasCache(fileName, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook := NopHook{}
+	oldDB.AddHook(hook)
+	oldDB.SetTxRetry(2)
+	reloaded := make(chan *DB, 1)
+	w := NewWatcher(NewIniLoader(fileName), time.Hour, 0).OnReload(func(section string, oldDB, newDB *DB, err error) {
+		if err != nil {
+			t.Error(err)
+		}
+		reloaded <- newDB
+	})
+	if err := NewWatcher(NewIniLoader(fileName), 0, 0).Start(); err == nil {
+		t.Fatal("expect the interval error")
+	}
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// not changed
+	w.Check()
+	if len(reloaded) != 0 {
+		t.Fatal("expect not reloaded")
+	}
+
+	if err := ioutil.WriteFile(fileName, []byte("[master]\ndriver: testdb\ndsn: master2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	w.Check()
+	newDB := <-reloaded
+	defer newDB.Close()
+	if newDB.Config().Dsn != "master2" {
+		t.Fatalf("%+v", newDB.Config())
+	}
+	db, err := HasCache(fileName, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db != newDB || db == oldDB {
+		t.Fatal("expect the new db in cache")
+	}
+	if hooks := newDB.Hooks(); len(hooks) != 1 || hooks[0] != Hook(hook) || newDB.txRetry != 2 {
+		t.Fatalf("expect the hooks and tx retry inherited: %+v, %d", hooks, newDB.txRetry)
+	}
+
+	// rotate the secret file
+	secretFile := writeTestIni(t, "master3")
+	if err := ioutil.WriteFile(fileName, []byte("[master]\ndriver: testdb\ndsn: ${file:"+secretFile+"}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	w.Check()
+	newDB = <-reloaded
+	defer newDB.Close()
+	if err := ioutil.WriteFile(secretFile, []byte("master-4"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	w.Check()
+	newDB = <-reloaded
+	defer newDB.Close()
+	if newDB.Config().Dsn != "master-4" {
+		t.Fatalf("%+v", newDB.Config())
+	}
+}
+
+func TestCacheContext(t *testing.T) {
+	fileName := writeTestIni(t, `
+[master]
+driver: testdb
+dsn: master
+
+[refused]
+driver: testdb
+dsn: refused
+`)
+	defer os.Remove(fileName)
+
+	ctx := context.TODO()
+	if _, err := GetCacheContext(ctx, fileName, "refused"); err == nil {
+		t.Fatal("expect ping error")
+	}
+	db, err := GetCacheContext(ctx, fileName, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// drain the in-use connection
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make(chan error, 1)
+	go func() {
+		closeCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+		defer cancel()
+		result <- CloseCacheContext(closeCtx)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if _, err := HasCache(fileName, "master"); !ErrCacheClosing.Equal(err) {
+		t.Fatal(err)
+	}
+	if db.IsClose() {
+		t.Fatal("expect draining")
+	}
+	conn.Close()
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+	if !db.IsClose() {
+		t.Fatal("expect closed")
+	}
+
+	// timeout of draining
+	db, err = GetCacheContext(ctx, fileName, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err = db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	closeCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	err = CloseCacheContext(closeCtx)
+	closeErr, ok := err.(*CloseCacheError)
+	if !ok || len(closeErr.Errs) != 1 || closeErr.Errs[CacheKey{fileName, "master"}] == nil {
+		t.Fatal(err)
+	}
+	if !db.IsClose() {
+		t.Fatal("expect closed")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r1 := NewRegistry()
+	r2 := NewRegistry()
+	registered := []CacheKey{}
+	closed := []CacheKey{}
+	r1.OnRegister(func(key CacheKey, db *DB) {
+		registered = append(registered, key)
+	}).OnClose(func(key CacheKey, db *DB, err error) {
+		closed = append(closed, key)
+	})
+
+	// the keys not collided
+	db1, _ := newTestDB("mysql", nil)
+	db2, _ := newTestDB("mysql", nil)
+	r1.Register(CacheKey{"a.ini", "bc"}, db1)
+	r1.Register(CacheKey{"a.inib", "c"}, db2)
+	if keys := r1.List(); len(keys) != 2 || keys[0] != (CacheKey{"a.ini", "bc"}) || keys[1] != (CacheKey{"a.inib", "c"}) {
+		t.Fatal(keys)
+	}
+	if db, ok := r1.Lookup(CacheKey{"a.ini", "bc"}); !ok || db != db1 {
+		t.Fatal("expect db1")
+	}
+	if len(r2.List()) != 0 {
+		t.Fatal(r2.List())
+	}
+
+	if !r1.Remove(CacheKey{"a.ini", "bc"}) || r1.Remove(CacheKey{"a.ini", "bc"}) {
+		t.Fatal("expect removed once")
+	}
+	if !db1.IsClose() {
+		t.Fatal("expect closed")
+	}
+	db2.Close()
+	if len(r1.List()) != 0 {
+		t.Fatal(r1.List())
+	}
+	if len(registered) != 2 || len(closed) != 2 || closed[0] != (CacheKey{"a.ini", "bc"}) || closed[1] != (CacheKey{"a.inib", "c"}) {
+		t.Fatal(registered, closed)
+	}
+
+	// open by loader
+	fileName := writeTestIni(t, `
+[master]
+driver: testdb
+dsn: master
+`)
+	defer os.Remove(fileName)
+	db, err := r2.Get(NewIniLoader(fileName), "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r1.Lookup(CacheKey{fileName, "master"}); ok {
+		t.Fatal("expect not in r1")
+	}
+	r2.Close()
+	if !db.IsClose() || len(r2.List()) != 0 {
+		t.Fatal("expect closed")
+	}
+}
+
+// a loader which is slow to load the config.
+type slowLoader struct {
+	delay time.Duration
+	loads int32
+}
+
+func (l *slowLoader) Source() string {
+	return "slow"
+}
+
+func (l *slowLoader) Load(sectionName string) (*Config, error) {
+	atomic.AddInt32(&l.loads, 1)
+	time.Sleep(l.delay)
+	return &Config{Source: l.Source(), Section: sectionName, DriverName: "testdb", Dsn: sectionName, MaxIdleConns: -1}, nil
+}
+
+func TestRegistryConcurrentOpen(t *testing.T) {
+	r := NewRegistry()
+	defer r.Close()
+	loader := &slowLoader{delay: 100 * time.Millisecond}
+
+	// the concurrent lookups of a key share one open
+	dbs := make([]*DB, 10)
+	wg := sync.WaitGroup{}
+	for i := range dbs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			db, err := r.Get(loader, "master")
+			if err != nil {
+				t.Error(err)
+			}
+			dbs[i] = db
+		}(i)
+	}
+
+	// the lookup of the other key is not blocked by the opening
+	time.Sleep(10 * time.Millisecond)
+	cached, _ := newTestDB("mysql", nil)
+	r.Register(CacheKey{"slow", "cached"}, cached)
+	start := time.Now()
+	if db, err := r.Get(loader, "cached"); err != nil || db != cached {
+		t.Fatal(err)
+	}
+	if time.Since(start) > 50*time.Millisecond {
+		t.Fatal("blocked by the opening")
+	}
+
+	wg.Wait()
+	if loads := atomic.LoadInt32(&loader.loads); loads != 1 {
+		t.Fatal(loads)
+	}
+	for _, db := range dbs {
+		if db == nil || db != dbs[0] {
+			t.Fatal("expect the same db")
+		}
+	}
+
+	// the waiting is canceled by ctx
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	go r.Get(loader, "log")
+	time.Sleep(10 * time.Millisecond)
+	if _, err := r.GetContext(ctx, loader, "log"); err == nil {
+		t.Fatal("expect canceled")
+	}
+	if _, err := r.Get(loader, "log"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// the lookup throughput of a cached key while the other keys are opening.
+func BenchmarkRegistryGet(b *testing.B) {
+	r := NewRegistry()
+	defer r.Close()
+	loader := &slowLoader{delay: time.Millisecond}
+	if _, err := r.Get(loader, "master"); err != nil {
+		b.Fatal(err)
+	}
+
+	// keep opening the new sections in background.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+				r.Get(loader, fmt.Sprintf("section_%d", i))
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := r.Get(loader, "master"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
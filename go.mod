@@ -1,10 +1,12 @@
 module github.com/gwaylib/database
 
-go 1.13
+go 1.16
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/go-ini/ini v1.48.0
 	github.com/gwaylib/errors v0.0.0-20190905023356-162e59439c92
 	github.com/gwaylib/log v0.0.0-20190829041528-b6c28711ef53
 	github.com/jmoiron/sqlx v1.2.0
+	gopkg.in/yaml.v2 v2.4.0
 )
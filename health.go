@@ -0,0 +1,241 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gwaylib/errors"
+)
+
+type HealthState int
+
+const (
+	HEALTH_UNKNOWN  HealthState = iota // not checked yet
+	HEALTH_HEALTHY                     // ping ok
+	HEALTH_DEGRADED                    // ping slow, or failed but not reach the down times
+	HEALTH_DOWN                        // ping failed continuously
+)
+
+func (s HealthState) String() string {
+	switch s {
+	case HEALTH_HEALTHY:
+		return "healthy"
+	case HEALTH_DEGRADED:
+		return "degraded"
+	case HEALTH_DOWN:
+		return "down"
+	}
+	return "unknown"
+}
+
+// The health of db checked by the HealthChecker.
+type Health struct {
+	State     HealthState
+	Latency   time.Duration // the latency of the last ping
+	Failures  int           // the continuous failures of ping
+	CheckedAt time.Time
+	Err       error // the error of the last ping
+}
+
+// Ping the cached dbs at the interval in background, and track the health of them.
+// When a db is down and its config has the FallbackDsns, it will be switched to the next dsn,
+// a new db opened with that dsn inherits the hooks and tx retry of the old one and is swapped into the cache,
+// then the old one is closed after its in-use connections returned or the check interval,
+// so the caller should get the db by GetCache when using it.
+type HealthChecker struct {
+	registry    *Registry
+	interval    time.Duration
+	timeout     time.Duration
+	slowLatency time.Duration
+	downTimes   int
+
+	mu         sync.Mutex
+	onChange   func(db *DB, health Health)
+	onFailover func(oldDB, newDB *DB, err error)
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// Make a health checker with the ping interval,
+// the ping timeout is the interval, the slow latency is 1s, and the down times is 3 by default.
+func NewHealthChecker(interval time.Duration) *HealthChecker {
+	return defaultRegistry.NewHealthChecker(interval)
+}
+
+// Make a health checker for the dbs in the registry, see NewHealthChecker.
+func (r *Registry) NewHealthChecker(interval time.Duration) *HealthChecker {
+	return &HealthChecker{
+		registry:    r,
+		interval:    interval,
+		timeout:     interval,
+		slowLatency: time.Second,
+		downTimes:   3,
+		stop:        make(chan struct{}),
+	}
+}
+
+// Set the timeout of ping, the latency over slowLatency is degraded,
+// and the db is down after the ping failed continuously downTimes.
+func (h *HealthChecker) SetThreshold(timeout, slowLatency time.Duration, downTimes int) *HealthChecker {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.timeout = timeout
+	h.slowLatency = slowLatency
+	h.downTimes = downTimes
+	return h
+}
+
+// Set a hook to observe the state changing of db.
+func (h *HealthChecker) OnChange(fn func(db *DB, health Health)) *HealthChecker {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.onChange = fn
+	return h
+}
+
+// Set a hook to observe the failover, err is not nil when all the dsns are failed, and the old db is kept.
+func (h *HealthChecker) OnFailover(fn func(oldDB, newDB *DB, err error)) *HealthChecker {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.onFailover = fn
+	return h
+}
+
+// Start the checking in background, it returns an error when the interval is not positive.
+func (h *HealthChecker) Start() error {
+	if h.interval <= 0 {
+		return errors.New("error health check interval").As(h.interval)
+	}
+	go func() {
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				h.Check()
+			case <-h.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop the checking.
+func (h *HealthChecker) Stop() {
+	h.stopOnce.Do(func() {
+		close(h.stop)
+	})
+}
+
+// Check the cached dbs once.
+func (h *HealthChecker) Check() {
+	wg := sync.WaitGroup{}
+	for key, db := range h.registry.snapshot() {
+		if db.IsClose() {
+			continue
+		}
+		wg.Add(1)
+		go func(key CacheKey, db *DB) {
+			defer wg.Done()
+			h.check(key, db)
+		}(key, db)
+	}
+	wg.Wait()
+}
+
+func (h *HealthChecker) check(key CacheKey, db *DB) {
+	h.mu.Lock()
+	timeout, slowLatency, downTimes := h.timeout, h.slowLatency, h.downTimes
+	onChange := h.onChange
+	h.mu.Unlock()
+
+	start := time.Now()
+	err := h.ping(db, timeout)
+	health := Health{Latency: time.Since(start), CheckedAt: time.Now(), Err: err}
+
+	db.mu.Lock()
+	old := db.health
+	if err != nil {
+		health.Failures = old.Failures + 1
+	}
+	switch {
+	case err == nil && health.Latency < slowLatency:
+		health.State = HEALTH_HEALTHY
+	case err != nil && health.Failures >= downTimes:
+		health.State = HEALTH_DOWN
+	default:
+		health.State = HEALTH_DEGRADED
+	}
+	db.health = health
+	db.mu.Unlock()
+
+	if old.State != health.State && onChange != nil {
+		onChange(db, health)
+	}
+	if health.State == HEALTH_DOWN {
+		h.failover(key, db, timeout)
+	}
+}
+
+func (h *HealthChecker) ping(db *DB, timeout time.Duration) error {
+	ctx := context.TODO()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return db.PingContext(ctx)
+}
+
+// switch the db to the next available dsn of config.
+func (h *HealthChecker) failover(key CacheKey, db *DB, timeout time.Duration) {
+	cfg := db.Config()
+	if cfg == nil || len(cfg.FallbackDsns) == 0 {
+		return
+	}
+	h.mu.Lock()
+	onFailover := h.onFailover
+	h.mu.Unlock()
+	notify := func(newDB *DB, err error) {
+		if onFailover != nil {
+			onFailover(db, newDB, err)
+		}
+	}
+
+	total := len(cfg.FallbackDsns) + 1
+	var lastErr error
+	for i := 1; i < total; i++ {
+		idx := (db.DsnIndex() + i) % total
+		newDB, err := openConfigDsn(context.TODO(), cfg, idx, false)
+		if err != nil {
+			lastErr = errors.As(err, cfg.Source, cfg.Section, idx)
+			continue
+		}
+		start := time.Now()
+		if err := h.ping(newDB, timeout); err != nil {
+			// close the sql.DB only, it is not in the cache.
+			newDB.DB.Close()
+			lastErr = errors.As(err, cfg.Source, cfg.Section, idx)
+			continue
+		}
+		newDB.health = Health{State: HEALTH_HEALTHY, Latency: time.Since(start), CheckedAt: time.Now()}
+		newDB.inherit(db)
+		if !h.registry.swap(key, db, newDB) {
+			// the old one has been removed from the cache.
+			newDB.DB.Close()
+			return
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), h.interval)
+			defer cancel()
+			drainDB(ctx, db)
+			Close(db)
+		}()
+		notify(newDB, nil)
+		return
+	}
+	notify(nil, lastErr)
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHealthChecker(t *testing.T) {
+	fileName := writeTestIni(t, `
+[master]
+driver: testdb
+dsn: refused
+fallback_dsn: refused2 | ok
+slow_threshold: 1
+`)
+	defer os.Remove(fileName)
+
+	db, err := HasCache(fileName, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Close(db)
+	db.AddHook(NopHook{})
+	db.SetTxRetry(1)
+	if len(db.Config().FallbackDsns) != 2 || db.Health().State != HEALTH_UNKNOWN {
+		t.Fatal(db.Config().FallbackDsns, db.Health())
+	}
+
+	if err := NewHealthChecker(0).Start(); err == nil {
+		t.Fatal("expect the interval error")
+	}
+
+	changes := []HealthState{}
+	var failoverErr error
+	var newDB *DB
+	h := NewHealthChecker(time.Minute).SetThreshold(time.Second, time.Second, 2)
+	h.OnChange(func(db *DB, health Health) {
+		changes = append(changes, health.State)
+	}).OnFailover(func(oldDB, db *DB, err error) {
+		newDB, failoverErr = db, err
+	})
+
+	h.Check()
+	if health := db.Health(); health.State != HEALTH_DEGRADED || health.Failures != 1 || health.Err == nil {
+		t.Fatal(health)
+	}
+	h.Check()
+	if db.Health().State != HEALTH_DOWN {
+		t.Fatal(db.Health())
+	}
+	if failoverErr != nil || newDB == nil {
+		t.Fatal(failoverErr)
+	}
+	defer Close(newDB)
+	cached, err := HasCache(fileName, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached != newDB || cached.DsnIndex() != 2 || cached.Health().State != HEALTH_HEALTHY {
+		t.Fatal(cached.DsnIndex(), cached.Health())
+	}
+	// the slow query hook is made by the config, and the others are inherited.
+	if hooks := cached.Hooks(); len(hooks) != 2 || hooks[0] != Hook(cached.slowHook) || hooks[1] != Hook(NopHook{}) || cached.txRetry != 1 {
+		t.Fatal(hooks, cached.txRetry)
+	}
+	if len(changes) != 2 || changes[0] != HEALTH_DEGRADED || changes[1] != HEALTH_DOWN {
+		t.Fatal(changes)
+	}
+
+	h.Check()
+	if cached.Health().State != HEALTH_HEALTHY || len(changes) != 2 {
+		t.Fatal(cached.Health(), changes)
+	}
+}
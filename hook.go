@@ -0,0 +1,265 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// The operations of HookEvent.
+const (
+	HOOK_OP_QUERY    = "query"
+	HOOK_OP_EXEC     = "exec"
+	HOOK_OP_BEGIN    = "begin"
+	HOOK_OP_COMMIT   = "commit"
+	HOOK_OP_ROLLBACK = "rollback"
+)
+
+// The event of an operation passed to the hooks.
+type HookEvent struct {
+	// the db which the operation runs on, it is the db of tx for the operations in a transaction.
+	DB *DB
+
+	Op    string
+	Query string
+	Args  []interface{}
+
+	// the following are set after the operation done.
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+	// the rows affected of exec, or the rows scanned of query, -1 if unknown.
+	Rows int64
+}
+
+// Return the first keyword of the query in upper case, like SELECT, INSERT or WITH, empty if no query.
+func (e *HookEvent) Operation() string {
+	fields := strings.Fields(e.Query)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(fields[0])
+}
+
+// Return the table of the query for SELECT, INSERT, UPDATE, DELETE, REPLACE and MERGE, empty if unknown.
+// It is the table after the FROM, INTO or UPDATE keyword, and the quotes of it are trimmed.
+func (e *HookEvent) Table() string {
+	fields := strings.Fields(e.Query)
+	if len(fields) == 0 {
+		return ""
+	}
+	keyword := ""
+	switch strings.ToUpper(fields[0]) {
+	case "SELECT", "DELETE":
+		keyword = "FROM"
+	case "INSERT", "REPLACE", "MERGE":
+		keyword = "INTO"
+	case "UPDATE":
+		keyword = "UPDATE"
+	default:
+		return ""
+	}
+	for i, field := range fields[:len(fields)-1] {
+		if strings.ToUpper(field) != keyword {
+			continue
+		}
+		table := fields[i+1]
+		if idx := strings.IndexAny(table, "(,;"); idx >= 0 {
+			table = table[:idx]
+		}
+		return strings.Trim(table, "`\"[]")
+	}
+	return ""
+}
+
+// The hook of the operations by the package functions, such as QueryStruct, InsertStruct, Exec and WithTx.
+// The Before methods return the context for the operation, so a hook can carry the values like a tracing span,
+// and the After methods receive that context.
+// The hooks are called in the order of adding for Before, and the reverse order for After.
+//
+// The transaction is one event from BeforeBegin to AfterCommit or AfterRollback,
+// the AfterRollback is called with the error of begin when begin failed.
+type Hook interface {
+	BeforeQuery(ctx context.Context, e *HookEvent) context.Context
+	AfterQuery(ctx context.Context, e *HookEvent)
+
+	BeforeExec(ctx context.Context, e *HookEvent) context.Context
+	AfterExec(ctx context.Context, e *HookEvent)
+
+	BeforeBegin(ctx context.Context, e *HookEvent) context.Context
+	AfterCommit(ctx context.Context, e *HookEvent)
+	AfterRollback(ctx context.Context, e *HookEvent)
+}
+
+// A hook does nothing, embed it to implement the needed methods of Hook only.
+type NopHook struct{}
+
+func (NopHook) BeforeQuery(ctx context.Context, e *HookEvent) context.Context { return ctx }
+func (NopHook) AfterQuery(ctx context.Context, e *HookEvent)                  {}
+func (NopHook) BeforeExec(ctx context.Context, e *HookEvent) context.Context  { return ctx }
+func (NopHook) AfterExec(ctx context.Context, e *HookEvent)                   {}
+func (NopHook) BeforeBegin(ctx context.Context, e *HookEvent) context.Context { return ctx }
+func (NopHook) AfterCommit(ctx context.Context, e *HookEvent)                 {}
+func (NopHook) AfterRollback(ctx context.Context, e *HookEvent)               {}
+
+// Add the hooks to the db, they are inherited by the *Tx of WithTx,
+// but not called with the *sql.Tx of Begin and BeginTx.
+func (db *DB) AddHook(hooks ...Hook) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	// copy on write, so the running operations are not affected.
+	newHooks := make([]Hook, 0, len(db.hooks)+len(hooks))
+	newHooks = append(newHooks, db.hooks...)
+	db.hooks = append(newHooks, hooks...)
+}
+
+// Return the hooks of db.
+func (db *DB) Hooks() []Hook {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.hooks
+}
+
+// the executor which has the hooks, like DB, Tx and Cluster.
+type hookHolder interface {
+	hookDB() *DB
+}
+
+func (db *DB) hookDB() *DB {
+	return db
+}
+func (tx *Tx) hookDB() *DB {
+	return tx.db
+}
+func (c *Cluster) hookDB() *DB {
+	return c.Primary()
+}
+
+// the queryer which routes the query to another one, like Cluster.
+type queryRouter interface {
+	queryer(ctx context.Context) Queryer
+}
+
+// return the queryer which runs the query actually, such as the replica chosen by the Cluster,
+// so the hooks are run with the db of it.
+func routeQuery(db Queryer, ctx context.Context) Queryer {
+	if r, ok := db.(queryRouter); ok {
+		return r.queryer(ctx)
+	}
+	return db
+}
+
+// the running event of hooks
+type hookRun struct {
+	ctx   context.Context
+	hooks []Hook
+	event *HookEvent
+}
+
+// call the Before of hooks, return nil if the exec has no hook.
+func startHooks(exec interface{}, ctx context.Context, op, query string, args []interface{}) *hookRun {
+	holder, ok := exec.(hookHolder)
+	if !ok {
+		return nil
+	}
+	db := holder.hookDB()
+	hooks := db.Hooks()
+	if len(hooks) == 0 {
+		return nil
+	}
+	run := &hookRun{
+		ctx:   ctx,
+		hooks: hooks,
+		event: &HookEvent{DB: db, Op: op, Query: query, Args: args, Start: time.Now(), Rows: -1},
+	}
+	for _, h := range hooks {
+		switch op {
+		case HOOK_OP_QUERY:
+			run.ctx = h.BeforeQuery(run.ctx, run.event)
+		case HOOK_OP_EXEC:
+			run.ctx = h.BeforeExec(run.ctx, run.event)
+		case HOOK_OP_BEGIN:
+			run.ctx = h.BeforeBegin(run.ctx, run.event)
+		}
+	}
+	return run
+}
+
+// call the After of hooks, op is the final operation, like HOOK_OP_COMMIT for HOOK_OP_BEGIN.
+func (run *hookRun) end(op string, rows int64, err error) {
+	if run == nil {
+		return
+	}
+	e := run.event
+	e.Op = op
+	e.Duration = time.Since(e.Start)
+	e.Rows = rows
+	e.Err = err
+	for i := len(run.hooks) - 1; i >= 0; i-- {
+		h := run.hooks[i]
+		switch op {
+		case HOOK_OP_QUERY:
+			h.AfterQuery(run.ctx, e)
+		case HOOK_OP_EXEC:
+			h.AfterExec(run.ctx, e)
+		case HOOK_OP_COMMIT:
+			h.AfterCommit(run.ctx, e)
+		case HOOK_OP_ROLLBACK:
+			h.AfterRollback(run.ctx, e)
+		}
+	}
+}
+
+// run fn with the hooks of exec, fn returns the rows affected or scanned.
+func withHooks(exec interface{}, ctx context.Context, op, query string, args []interface{}, fn func(ctx context.Context) (int64, error)) error {
+	run := startHooks(exec, ctx, op, query, args)
+	if run == nil {
+		_, err := fn(ctx)
+		return err
+	}
+	rows, err := fn(run.ctx)
+	run.end(op, rows, err)
+	return err
+}
+
+// exec the query with the hooks of exec.
+func execContext(exec Execer, ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+	err := withHooks(exec, ctx, HOOK_OP_EXEC, query, args, func(ctx context.Context) (int64, error) {
+		var err error
+		result, err = exec.ExecContext(ctx, query, args...)
+		if err != nil {
+			return -1, err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return -1, nil
+		}
+		return rows, nil
+	})
+	return result, err
+}
+
+// query with the hooks of db, the rows is unknown for the hooks.
+func queryContext(db Queryer, ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	db = routeQuery(db, ctx)
+	var rows *sql.Rows
+	err := withHooks(db, ctx, HOOK_OP_QUERY, query, args, func(ctx context.Context) (int64, error) {
+		var err error
+		rows, err = db.QueryContext(ctx, query, args...)
+		return -1, err
+	})
+	return rows, err
+}
+
+// query a row with the hooks of db, the error of hooks is the error of row.
+func queryRowContext(db Queryer, ctx context.Context, query string, args ...interface{}) *sql.Row {
+	db = routeQuery(db, ctx)
+	var row *sql.Row
+	withHooks(db, ctx, HOOK_OP_QUERY, query, args, func(ctx context.Context) (int64, error) {
+		row = db.QueryRowContext(ctx, query, args...)
+		return -1, row.Err()
+	})
+	return row
+}
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type testHookKey struct{}
+
+// a hook records the events
+type testHook struct {
+	NopHook
+	name   string
+	events *[]string
+}
+
+func (h *testHook) record(ctx context.Context, phase string, e *HookEvent) {
+	val, _ := ctx.Value(testHookKey{}).(string)
+	*h.events = append(*h.events, fmt.Sprintf("%s %s %s rows=%d err=%v ctx=%s", h.name, phase, e.Op, e.Rows, e.Err != nil, val))
+}
+
+func (h *testHook) BeforeQuery(ctx context.Context, e *HookEvent) context.Context {
+	h.record(ctx, "before", e)
+	return context.WithValue(ctx, testHookKey{}, h.name)
+}
+func (h *testHook) AfterQuery(ctx context.Context, e *HookEvent) {
+	h.record(ctx, "after", e)
+}
+func (h *testHook) BeforeExec(ctx context.Context, e *HookEvent) context.Context {
+	h.record(ctx, "before", e)
+	return ctx
+}
+func (h *testHook) AfterExec(ctx context.Context, e *HookEvent) {
+	h.record(ctx, "after", e)
+}
+func (h *testHook) BeforeBegin(ctx context.Context, e *HookEvent) context.Context {
+	h.record(ctx, "before", e)
+	return ctx
+}
+func (h *testHook) AfterCommit(ctx context.Context, e *HookEvent) {
+	h.record(ctx, "after", e)
+}
+func (h *testHook) AfterRollback(ctx context.Context, e *HookEvent) {
+	h.record(ctx, "after", e)
+}
+
+func TestHooks(t *testing.T) {
+	db, _ := newTestDB("mysql", func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		if strings.HasPrefix(query, "SELECT") {
+			return []string{"id"}, [][]driver.Value{{int64(1)}, {int64(2)}}, nil
+		}
+		if strings.HasPrefix(query, "DELETE") {
+			return nil, nil, errors.New("delete failed")
+		}
+		return nil, nil, nil
+	})
+	events := []string{}
+	db.AddHook(&testHook{name: "a", events: &events}, &testHook{name: "b", events: &events})
+
+	ids := []int64{}
+	if err := QueryElems(db, &ids, "SELECT id FROM testing"); err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{
+		"a before query rows=-1 err=false ctx=",
+		"b before query rows=-1 err=false ctx=a",
+		"b after query rows=2 err=false ctx=b",
+		"a after query rows=2 err=false ctx=b",
+	}
+	if fmt.Sprint(events) != fmt.Sprint(expect) {
+		t.Fatal(events)
+	}
+
+	// the rows are the appended only
+	events = events[:0]
+	if err := QueryElems(db, &ids, "SELECT id FROM testing"); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 4 || len(events) != 4 || events[3] != "a after query rows=2 err=false ctx=b" {
+		t.Fatal(ids, events)
+	}
+
+	// the hooks are inherited by tx
+	events = events[:0]
+	if err := db.WithTx(context.TODO(), nil, func(tx *Tx) error {
+		if _, err := InsertStruct(tx, &ReflectTestStruct6{Name: "a"}, "testing"); err != nil {
+			return err
+		}
+		return ExecMultiTx(tx, []*MultiTx{NewMultiTx("DELETE FROM testing")})
+	}); err == nil {
+		t.Fatal("expect error")
+	}
+	expect = []string{
+		"a before begin rows=-1 err=false ctx=",
+		"b before begin rows=-1 err=false ctx=",
+		"a before exec rows=-1 err=false ctx=",
+		"b before exec rows=-1 err=false ctx=",
+		"b after exec rows=1 err=false ctx=",
+		"a after exec rows=1 err=false ctx=",
+		"a before exec rows=-1 err=false ctx=",
+		"b before exec rows=-1 err=false ctx=",
+		"b after exec rows=-1 err=true ctx=",
+		"a after exec rows=-1 err=true ctx=",
+		"b after rollback rows=-1 err=true ctx=",
+		"a after rollback rows=-1 err=true ctx=",
+	}
+	if fmt.Sprint(events) != fmt.Sprint(expect) {
+		t.Fatal(events)
+	}
+
+	events = events[:0]
+	if err := db.WithTx(context.TODO(), nil, func(tx *Tx) error {
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 4 || events[3] != "a after commit rows=-1 err=false ctx=" {
+		t.Fatal(events)
+	}
+
+	// the page query
+	events = events[:0]
+	_, _, _, err := NewPageSql("SELECT count(*) FROM testing", "SELECT id FROM testing").QueryPageArr(db, false, NewPageArgs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 4 || events[3] != "a after query rows=2 err=false ctx=b" {
+		t.Fatal(events)
+	}
+}
+
+func TestHookEventOperation(t *testing.T) {
+	for query, expect := range map[string][2]string{
+		"":                                   {"", ""},
+		"select id FROM testing":             {"SELECT", "testing"},
+		"\n  INSERT INTO testing(id) VALUES": {"INSERT", "testing"},
+		"UPDATE `testing` SET name=?":        {"UPDATE", "testing"},
+		"DELETE FROM \"testing\" WHERE id=?": {"DELETE", "testing"},
+		"SELECT count(*) FROM [testing]":     {"SELECT", "testing"},
+		"CREATE TABLE testing (id INTEGER)":  {"CREATE", ""},
+	} {
+		e := &HookEvent{Query: query}
+		if e.Operation() != expect[0] || e.Table() != expect[1] {
+			t.Fatal(query, e.Operation(), e.Table())
+		}
+	}
+}
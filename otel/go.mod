@@ -0,0 +1,31 @@
+module github.com/gwaylib/database/otel
+
+go 1.20
+
+require (
+	github.com/gwaylib/database v0.0.0-00010101000000-000000000000
+	github.com/mattn/go-sqlite3 v1.14.17
+	go.opentelemetry.io/otel v1.24.0
+	go.opentelemetry.io/otel/sdk v1.24.0
+	go.opentelemetry.io/otel/trace v1.24.0
+)
+
+require (
+	github.com/BurntSushi/toml v1.3.2 // indirect
+	github.com/go-ini/ini v1.48.0 // indirect
+	github.com/go-logr/logr v1.4.1 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/gwaylib/errors v0.0.0-20190905023356-162e59439c92 // indirect
+	github.com/gwaylib/log v0.0.0-20190829041528-b6c28711ef53 // indirect
+	github.com/jmoiron/sqlx v1.2.0 // indirect
+	github.com/labstack/gommon v0.3.0 // indirect
+	github.com/mattn/go-colorable v0.1.2 // indirect
+	github.com/mattn/go-isatty v0.0.9 // indirect
+	github.com/stretchr/testify v1.11.1 // indirect
+	go.opentelemetry.io/otel/metric v1.24.0 // indirect
+	golang.org/x/sys v0.17.0 // indirect
+	gopkg.in/ini.v1 v1.67.3 // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
+)
+
+replace github.com/gwaylib/database => ../
@@ -0,0 +1,124 @@
+// Package otel traces the database operations of github.com/gwaylib/database by OpenTelemetry.
+//
+// It is a separate module, so the core package has no dependency of OpenTelemetry.
+package otel
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gwaylib/database"
+	otelapi "go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/gwaylib/database/otel"
+
+// the span name of transaction.
+const txSpanName = "transaction"
+
+// the context key of the span started by a Hook.
+type spanContextKey struct {
+	hook *Hook
+}
+
+// The hook creates a client span for each query, exec and transaction, with the attributes:
+// db.system, db.statement, db.operation, db.rows_affected or db.rows_returned, and the error.
+//
+// The span is the child of the span in the context of the *Context functions,
+// and the operations run with the Context of a Tx are the children of the transaction span.
+type Hook struct {
+	tracer trace.Tracer
+}
+
+// Make a tracing hook with the tracer provider, the global one is used when tp is nil.
+func NewHook(tp trace.TracerProvider) *Hook {
+	if tp == nil {
+		tp = otelapi.GetTracerProvider()
+	}
+	return &Hook{tracer: tp.Tracer(instrumentationName)}
+}
+
+// Add a tracing hook to the db, the hook is inherited by the transactions of the db.
+func Instrument(db *database.DB, tp trace.TracerProvider) *database.DB {
+	db.AddHook(NewHook(tp))
+	return db
+}
+
+// return the db.system of the driver name.
+func dbSystem(drvName string) string {
+	name := strings.ToLower(drvName)
+	switch {
+	case strings.Contains(name, "mysql"):
+		return "mysql"
+	case strings.Contains(name, "postgres"), strings.Contains(name, "pgx"):
+		return "postgresql"
+	case strings.Contains(name, "sqlite"):
+		return "sqlite"
+	case strings.Contains(name, "sqlserver"), strings.Contains(name, "mssql"):
+		return "mssql"
+	case strings.Contains(name, "oracle"), strings.Contains(name, "oci8"), strings.Contains(name, "godror"):
+		return "oracle"
+	}
+	return name
+}
+
+func (h *Hook) start(ctx context.Context, e *database.HookEvent) context.Context {
+	attrs := []attribute.KeyValue{attribute.String("db.system", dbSystem(e.DB.DriverName()))}
+	name := txSpanName
+	if op := e.Operation(); op != "" {
+		name = op
+		attrs = append(attrs,
+			attribute.String("db.statement", e.Query),
+			attribute.String("db.operation", op),
+		)
+	}
+	ctx, span := h.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return context.WithValue(ctx, spanContextKey{h}, span)
+}
+
+func (h *Hook) end(ctx context.Context, e *database.HookEvent, rowsKey string, attrs ...attribute.KeyValue) {
+	span, ok := ctx.Value(spanContextKey{h}).(trace.Span)
+	if !ok {
+		return
+	}
+	span.SetAttributes(attrs...)
+	if rowsKey != "" && e.Rows >= 0 {
+		span.SetAttributes(attribute.Int64(rowsKey, e.Rows))
+	}
+	if e.Err != nil {
+		span.RecordError(e.Err)
+		span.SetStatus(codes.Error, e.Err.Error())
+	}
+	span.End()
+}
+
+func (h *Hook) BeforeQuery(ctx context.Context, e *database.HookEvent) context.Context {
+	return h.start(ctx, e)
+}
+
+func (h *Hook) AfterQuery(ctx context.Context, e *database.HookEvent) {
+	h.end(ctx, e, "db.rows_returned")
+}
+
+func (h *Hook) BeforeExec(ctx context.Context, e *database.HookEvent) context.Context {
+	return h.start(ctx, e)
+}
+
+func (h *Hook) AfterExec(ctx context.Context, e *database.HookEvent) {
+	h.end(ctx, e, "db.rows_affected")
+}
+
+func (h *Hook) BeforeBegin(ctx context.Context, e *database.HookEvent) context.Context {
+	return h.start(ctx, e)
+}
+
+func (h *Hook) AfterCommit(ctx context.Context, e *database.HookEvent) {
+	h.end(ctx, e, "", attribute.String("db.operation", "COMMIT"))
+}
+
+func (h *Hook) AfterRollback(ctx context.Context, e *database.HookEvent) {
+	h.end(ctx, e, "", attribute.String("db.operation", "ROLLBACK"))
+}
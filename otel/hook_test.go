@@ -0,0 +1,90 @@
+package otel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gwaylib/database"
+	_ "github.com/mattn/go-sqlite3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func spanAttr(span sdktrace.ReadOnlySpan, key string) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestHook(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	db, err := database.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close(db)
+	db.SetMaxOpenConns(1)
+	Instrument(db, tp)
+
+	ctx, parent := tp.Tracer("test").Start(context.TODO(), "parent")
+	if _, err := database.ExecContext(db, ctx, "CREATE TABLE testing (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+	if err := db.WithTx(context.TODO(), nil, func(tx *database.Tx) error {
+		if _, err := database.ExecContext(tx, tx.Context(), "INSERT INTO testing (name) VALUES (?), (?)", "a", "b"); err != nil {
+			return err
+		}
+		ids := []int64{}
+		return database.QueryElemsContext(tx, tx.Context(), &ids, "SELECT id FROM testing")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.WithTx(context.TODO(), nil, func(tx *database.Tx) error {
+		_, err := database.ExecContext(tx, tx.Context(), "INSERT INTO unknown (name) VALUES (?)", "a")
+		return err
+	}); err == nil {
+		t.Fatal("expect error")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 7 {
+		t.Fatal(len(spans))
+	}
+	create := spans[0]
+	if create.Name() != "CREATE" || create.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Fatal(create.Name(), create.Parent())
+	}
+	if spanAttr(create, "db.system").AsString() != "sqlite" || spanAttr(create, "db.operation").AsString() != "CREATE" {
+		t.Fatal(create.Attributes())
+	}
+
+	insert, query, commit := spans[2], spans[3], spans[4]
+	if insert.Name() != "INSERT" || spanAttr(insert, "db.rows_affected").AsInt64() != 2 {
+		t.Fatal(insert.Name(), insert.Attributes())
+	}
+	if query.Name() != "SELECT" || spanAttr(query, "db.rows_returned").AsInt64() != 2 {
+		t.Fatal(query.Name(), query.Attributes())
+	}
+	if commit.Name() != "transaction" || spanAttr(commit, "db.operation").AsString() != "COMMIT" {
+		t.Fatal(commit.Name(), commit.Attributes())
+	}
+	if insert.Parent().SpanID() != commit.SpanContext().SpanID() || query.Parent().SpanID() != commit.SpanContext().SpanID() {
+		t.Fatal("expect the children of transaction")
+	}
+
+	failed, rollback := spans[5], spans[6]
+	if failed.Status().Code != codes.Error || len(failed.Events()) != 1 {
+		t.Fatal(failed.Status(), failed.Events())
+	}
+	if rollback.Status().Code != codes.Error || spanAttr(rollback, "db.operation").AsString() != "ROLLBACK" {
+		t.Fatal(rollback.Status(), rollback.Attributes())
+	}
+}
@@ -84,15 +84,15 @@ func (p PageSql) FmtPage(args ...interface{}) PageSql {
 	}
 }
 
-func (p *PageSql) QueryCount(db *DB, args ...interface{}) (int64, error) {
+func (p *PageSql) QueryCount(db Queryer, args ...interface{}) (int64, error) {
 	count := int64(0)
 	if err := QueryElem(db, &count, p.countSql, args...); err != nil {
-		return 0, errors.As(err)
+		return 0, withCause(errors.As(err), err)
 	}
 	return count, nil
 }
 
-func (p *PageSql) QueryPageArr(db *DB, doCount bool, args *PageArgs) (int64, []string, [][]interface{}, error) {
+func (p *PageSql) QueryPageArr(db Queryer, doCount bool, args *PageArgs) (int64, []string, [][]interface{}, error) {
 	total := int64(0)
 	dataArgs := args.args
 	if args.limit > 0 {
@@ -100,18 +100,18 @@ func (p *PageSql) QueryPageArr(db *DB, doCount bool, args *PageArgs) (int64, []s
 	}
 	titles, data, err := QueryPageArr(db, p.dataSql, dataArgs...)
 	if err != nil {
-		return total, nil, nil, errors.As(err)
+		return total, nil, nil, withCause(errors.As(err), err)
 	} else if doCount {
 		count, err := p.QueryCount(db, args.args...)
 		if err != nil {
-			return total, nil, nil, errors.As(err)
+			return total, nil, nil, withCause(errors.As(err), err)
 		}
 		total = count
 	}
 	return total, titles, data, nil
 }
 
-func (p *PageSql) QueryPageMap(db *DB, doCount bool, args *PageArgs) (int64, []string, []map[string]interface{}, error) {
+func (p *PageSql) QueryPageMap(db Queryer, doCount bool, args *PageArgs) (int64, []string, []map[string]interface{}, error) {
 	total := int64(0)
 	dataArgs := args.args
 	if args.limit > 0 {
@@ -119,11 +119,11 @@ func (p *PageSql) QueryPageMap(db *DB, doCount bool, args *PageArgs) (int64, []s
 	}
 	title, data, err := QueryPageMap(db, p.dataSql, dataArgs...)
 	if err != nil {
-		return total, nil, nil, errors.As(err)
+		return total, nil, nil, withCause(errors.As(err), err)
 	} else if doCount {
 		count, err := p.QueryCount(db, args.args...)
 		if err != nil {
-			return total, nil, nil, errors.As(err)
+			return total, nil, nil, withCause(errors.As(err), err)
 		}
 		total = count
 	}
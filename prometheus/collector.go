@@ -0,0 +1,253 @@
+// Package prometheus exports the metrics of the cached dbs of github.com/gwaylib/database to Prometheus.
+//
+// It is a separate module, so the core package has no dependency of Prometheus.
+package prometheus
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/gwaylib/database"
+	promapi "github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "gwaylib_db"
+
+// the labels of a cached db, they are the config file and section used in GetCache.
+var dbLabels = []string{"source", "section"}
+
+// The collector of the dbs in a registry, the metrics are labelled by the source and section of the cache key:
+//
+//	gwaylib_db_max_open_connections, gwaylib_db_open_connections,
+//	gwaylib_db_in_use_connections, gwaylib_db_idle_connections,
+//	gwaylib_db_wait_count_total, gwaylib_db_wait_duration_seconds_total,
+//	gwaylib_db_max_idle_closed_total, gwaylib_db_max_idle_time_closed_total, gwaylib_db_max_lifetime_closed_total
+//	    the sql.DBStats of the dbs in the registry.
+//	gwaylib_db_query_duration_seconds{operation,table}
+//	    the latency histogram of the queries and execs, the count of it is the count of queries.
+//	    The table label is limited by SetTables or SetMaxTables, the others are labelled as "other".
+//	gwaylib_db_errors_total{operation,class}
+//	    the errors of the queries, execs and transactions by class, the sql.ErrNoRows is not counted.
+//	gwaylib_db_transactions_total{result}
+//	    the transactions committed or rolled back.
+//
+// The operation metrics are collected by the hook added by Instrument,
+// so the Instrument should be set to the OnRegister of the registry.
+type Collector struct {
+	registry *database.Registry
+
+	maxOpen, open, inUse, idle       *promapi.Desc
+	waitCount, waitDuration          *promapi.Desc
+	maxIdleClosed, maxIdleTimeClosed *promapi.Desc
+	maxLifetimeClosed                *promapi.Desc
+
+	durations    *promapi.HistogramVec
+	errors       *promapi.CounterVec
+	transactions *promapi.CounterVec
+
+	tablesLock  sync.Mutex
+	allowTables map[string]bool // nil is not set
+	maxTables   int
+	tables      map[string]bool // the table labels used
+}
+
+// The max number of the table labels by default.
+const DEFAULT_MAX_TABLES = 100
+
+// The label of the tables out of limit.
+const TABLE_OTHER = "other"
+
+// Make a collector of the dbs in the registry, the default registry is used when r is nil.
+func NewCollector(r *database.Registry) *Collector {
+	if r == nil {
+		r = database.DefaultRegistry()
+	}
+	desc := func(name, help string) *promapi.Desc {
+		return promapi.NewDesc(promapi.BuildFQName(namespace, "", name), help, dbLabels, nil)
+	}
+	return &Collector{
+		registry:          r,
+		maxOpen:           desc("max_open_connections", "Maximum number of open connections to the database."),
+		open:              desc("open_connections", "The number of established connections both in use and idle."),
+		inUse:             desc("in_use_connections", "The number of connections currently in use."),
+		idle:              desc("idle_connections", "The number of idle connections."),
+		waitCount:         desc("wait_count_total", "The total number of connections waited for."),
+		waitDuration:      desc("wait_duration_seconds_total", "The total time blocked waiting for a new connection."),
+		maxIdleClosed:     desc("max_idle_closed_total", "The total number of connections closed due to SetMaxIdleConns."),
+		maxIdleTimeClosed: desc("max_idle_time_closed_total", "The total number of connections closed due to SetConnMaxIdleTime."),
+		maxLifetimeClosed: desc("max_lifetime_closed_total", "The total number of connections closed due to SetConnMaxLifetime."),
+		durations: promapi.NewHistogramVec(promapi.HistogramOpts{
+			Namespace: namespace,
+			Name:      "query_duration_seconds",
+			Help:      "The latency of the queries and execs.",
+			Buckets:   promapi.DefBuckets,
+		}, []string{"source", "section", "operation", "table"}),
+		errors: promapi.NewCounterVec(promapi.CounterOpts{
+			Namespace: namespace,
+			Name:      "errors_total",
+			Help:      "The errors of the queries, execs and transactions by class.",
+		}, []string{"source", "section", "operation", "class"}),
+		transactions: promapi.NewCounterVec(promapi.CounterOpts{
+			Namespace: namespace,
+			Name:      "transactions_total",
+			Help:      "The transactions committed or rolled back.",
+		}, []string{"source", "section", "result"}),
+		maxTables: DEFAULT_MAX_TABLES,
+		tables:    map[string]bool{},
+	}
+}
+
+// Set the allowed tables of the table label, the others are labelled as TABLE_OTHER.
+func (c *Collector) SetTables(tables ...string) *Collector {
+	c.tablesLock.Lock()
+	defer c.tablesLock.Unlock()
+	c.allowTables = map[string]bool{}
+	for _, table := range tables {
+		c.allowTables[table] = true
+	}
+	return c
+}
+
+// Set the max number of the table labels when the allowed tables is not set, default is DEFAULT_MAX_TABLES,
+// the tables first seen out of it are labelled as TABLE_OTHER.
+func (c *Collector) SetMaxTables(n int) *Collector {
+	c.tablesLock.Lock()
+	defer c.tablesLock.Unlock()
+	c.maxTables = n
+	return c
+}
+
+// return the label of table, it is limited by the allowed tables or the max tables.
+func (c *Collector) tableLabel(table string) string {
+	if len(table) == 0 {
+		return table
+	}
+	c.tablesLock.Lock()
+	defer c.tablesLock.Unlock()
+	if c.allowTables != nil {
+		if c.allowTables[table] {
+			return table
+		}
+		return TABLE_OTHER
+	}
+	if c.tables[table] {
+		return table
+	}
+	if len(c.tables) >= c.maxTables {
+		return TABLE_OTHER
+	}
+	c.tables[table] = true
+	return table
+}
+
+// Add the hook of collector to the db, the signature is the same as the OnRegister of Registry, like:
+//
+//	r.OnRegister(collector.Instrument)
+//
+// The db instrumented by this collector is ignored.
+func (c *Collector) Instrument(key database.CacheKey, db *database.DB) {
+	for _, h := range db.Hooks() {
+		if hook, ok := h.(*dbHook); ok && hook.collector == c {
+			return
+		}
+	}
+	db.AddHook(&dbHook{collector: c, source: key.Source, section: key.Section})
+}
+
+// implement the prometheus.Collector
+func (c *Collector) Describe(ch chan<- *promapi.Desc) {
+	for _, desc := range []*promapi.Desc{
+		c.maxOpen, c.open, c.inUse, c.idle,
+		c.waitCount, c.waitDuration,
+		c.maxIdleClosed, c.maxIdleTimeClosed, c.maxLifetimeClosed,
+	} {
+		ch <- desc
+	}
+	c.durations.Describe(ch)
+	c.errors.Describe(ch)
+	c.transactions.Describe(ch)
+}
+
+func (c *Collector) Collect(ch chan<- promapi.Metric) {
+	for _, key := range c.registry.List() {
+		db, ok := c.registry.Lookup(key)
+		if !ok || db.IsClose() {
+			continue
+		}
+		stats := db.Stats()
+		gauge := func(desc *promapi.Desc, val float64) {
+			ch <- promapi.MustNewConstMetric(desc, promapi.GaugeValue, val, key.Source, key.Section)
+		}
+		counter := func(desc *promapi.Desc, val float64) {
+			ch <- promapi.MustNewConstMetric(desc, promapi.CounterValue, val, key.Source, key.Section)
+		}
+		gauge(c.maxOpen, float64(stats.MaxOpenConnections))
+		gauge(c.open, float64(stats.OpenConnections))
+		gauge(c.inUse, float64(stats.InUse))
+		gauge(c.idle, float64(stats.Idle))
+		counter(c.waitCount, float64(stats.WaitCount))
+		counter(c.waitDuration, stats.WaitDuration.Seconds())
+		counter(c.maxIdleClosed, float64(stats.MaxIdleClosed))
+		counter(c.maxIdleTimeClosed, float64(stats.MaxIdleTimeClosed))
+		counter(c.maxLifetimeClosed, float64(stats.MaxLifetimeClosed))
+	}
+	c.durations.Collect(ch)
+	c.errors.Collect(ch)
+	c.transactions.Collect(ch)
+}
+
+// The classes of errors, the others are the ErrorClass.String() of database, like "timeout".
+const (
+	ERR_CLASS_CANCELED = "canceled"
+	ERR_CLASS_OTHER    = "other"
+)
+
+// return the class of error by the classifier of the db driver.
+func errorClass(db *database.DB, err error) string {
+	if errors.Is(err, context.Canceled) {
+		return ERR_CLASS_CANCELED
+	}
+	if class := db.ClassifyError(err); class != database.ERR_CLASS_UNKNOWN {
+		return class.String()
+	}
+	return ERR_CLASS_OTHER
+}
+
+// the hook of a db to collect the operation metrics.
+type dbHook struct {
+	database.NopHook
+	collector *Collector
+	source    string
+	section   string
+}
+
+func (h *dbHook) observe(e *database.HookEvent) {
+	op := strings.ToLower(e.Operation())
+	h.collector.durations.WithLabelValues(h.source, h.section, op, h.collector.tableLabel(e.Table())).Observe(e.Duration.Seconds())
+	// no rows is a result of query, not a failure.
+	if e.Err != nil && !errors.Is(e.Err, sql.ErrNoRows) {
+		h.collector.errors.WithLabelValues(h.source, h.section, op, errorClass(e.DB, e.Err)).Inc()
+	}
+}
+
+func (h *dbHook) AfterQuery(ctx context.Context, e *database.HookEvent) {
+	h.observe(e)
+}
+
+func (h *dbHook) AfterExec(ctx context.Context, e *database.HookEvent) {
+	h.observe(e)
+}
+
+func (h *dbHook) AfterCommit(ctx context.Context, e *database.HookEvent) {
+	h.collector.transactions.WithLabelValues(h.source, h.section, e.Op).Inc()
+	if e.Err != nil {
+		h.collector.errors.WithLabelValues(h.source, h.section, e.Op, errorClass(e.DB, e.Err)).Inc()
+	}
+}
+
+func (h *dbHook) AfterRollback(ctx context.Context, e *database.HookEvent) {
+	h.collector.transactions.WithLabelValues(h.source, h.section, e.Op).Inc()
+}
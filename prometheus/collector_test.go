@@ -0,0 +1,101 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gwaylib/database"
+	_ "github.com/mattn/go-sqlite3"
+	promapi "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	r := database.NewRegistry()
+	defer r.Close()
+	c := NewCollector(r)
+	r.OnRegister(c.Instrument)
+
+	db, err := database.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	r.Register(database.CacheKey{Source: "test.ini", Section: "master"}, db)
+	c.Instrument(database.CacheKey{Source: "test.ini", Section: "master"}, db)
+	if len(db.Hooks()) != 1 {
+		t.Fatal(db.Hooks())
+	}
+
+	if _, err := database.Exec(db, "CREATE TABLE testing (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.WithTx(context.TODO(), nil, func(tx *database.Tx) error {
+		_, err := database.Exec(tx, "INSERT INTO testing (name) VALUES (?)", "a")
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.WithTx(context.TODO(), nil, func(tx *database.Tx) error {
+		return errors.New("abort")
+	}); err == nil {
+		t.Fatal("expect error")
+	}
+	// no rows is not counted
+	name := ""
+	if err := database.QueryElem(db, &name, "SELECT name FROM testing WHERE id=?", 100); err == nil {
+		t.Fatal("expect error")
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), 0)
+	defer cancel()
+	if err := database.QueryElemContext(db, ctx, &name, "SELECT name FROM testing WHERE id=?", 1); err == nil {
+		t.Fatal("expect error")
+	}
+	canceled, cancelNow := context.WithCancel(context.TODO())
+	cancelNow()
+	if err := database.QueryStructsContext(db, canceled, &[]struct{}{}, "SELECT name FROM testing"); err == nil {
+		t.Fatal("expect error")
+	}
+	if _, err := database.Exec(db, "INSERT INTO testing (id, name) VALUES (?, ?)", 1, "b"); err == nil {
+		t.Fatal("expect error")
+	}
+
+	reg := promapi.NewPedanticRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	expect := `
+# HELP gwaylib_db_errors_total The errors of the queries, execs and transactions by class.
+# TYPE gwaylib_db_errors_total counter
+gwaylib_db_errors_total{class="canceled",operation="select",section="master",source="test.ini"} 1
+gwaylib_db_errors_total{class="timeout",operation="select",section="master",source="test.ini"} 1
+gwaylib_db_errors_total{class="unique_violation",operation="insert",section="master",source="test.ini"} 1
+# HELP gwaylib_db_max_open_connections Maximum number of open connections to the database.
+# TYPE gwaylib_db_max_open_connections gauge
+gwaylib_db_max_open_connections{section="master",source="test.ini"} 1
+# HELP gwaylib_db_transactions_total The transactions committed or rolled back.
+# TYPE gwaylib_db_transactions_total counter
+gwaylib_db_transactions_total{result="commit",section="master",source="test.ini"} 1
+gwaylib_db_transactions_total{result="rollback",section="master",source="test.ini"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expect),
+		"gwaylib_db_errors_total", "gwaylib_db_max_open_connections", "gwaylib_db_transactions_total"); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.CollectAndCount(c.durations); n != 3 {
+		t.Fatal(n)
+	}
+}
+
+func TestCollectorTables(t *testing.T) {
+	c := NewCollector(nil).SetMaxTables(1)
+	if c.tableLabel("a") != "a" || c.tableLabel("b") != TABLE_OTHER || c.tableLabel("a") != "a" || c.tableLabel("") != "" {
+		t.Fatal("expect the tables limited")
+	}
+	c.SetTables("b")
+	if c.tableLabel("a") != TABLE_OTHER || c.tableLabel("b") != "b" {
+		t.Fatal("expect the tables allowed")
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/gwaylib/errors"
 	"github.com/jmoiron/sqlx/reflectx"
@@ -13,87 +15,438 @@ import (
 type MultiTx struct {
 	Query string
 	Args  []interface{}
+
+	expectRows int64
+	checkRows  bool
 }
 
 func NewMultiTx(query string, args ...interface{}) *MultiTx {
-	return &MultiTx{query, args}
+	return &MultiTx{Query: query, Args: args}
+}
+
+// Set the expected rows affected of the MultiTx,
+// the ExecMultiTxResults will abort with a *RowsAffectedError when it is not matched.
+func (m *MultiTx) ExpectRows(rows int64) *MultiTx {
+	m.expectRows = rows
+	m.checkRows = true
+	return m
+}
+
+var (
+	ErrRowsAffected = errors.New("rows affected not match")
+)
+
+// The error of ExecMultiTxResults, it records the index and the query of the failed MultiTx.
+type MultiTxError struct {
+	Index int
+	Query string
+	Err   error
+}
+
+func (e *MultiTxError) Error() string {
+	return fmt.Sprintf("multi tx[%d] %s: %s", e.Index, e.Query, e.Err.Error())
+}
+func (e *MultiTxError) Unwrap() error {
+	return e.Err
 }
 
+// The error of the rows affected not match the ExpectRows of MultiTx,
+// it matches ErrRowsAffected by errors.Is of the standard library, and ErrRowsAffected.Equal.
+type RowsAffectedError struct {
+	Expect int64
+	Actual int64
+}
+
+func (e *RowsAffectedError) Error() string {
+	return ErrRowsAffected.As(e.Expect, e.Actual).Error()
+}
+func (e *RowsAffectedError) Is(target error) bool {
+	return target == ErrRowsAffected
+}
+
+// oracle not support the ';' end.
 const (
-	addObjSql = "INSERT INTO %s (%s) VALUES (%s);"
+	updateObjSql = "UPDATE %s SET %s WHERE %s"
+	deleteObjSql = "DELETE FROM %s WHERE %s"
 )
 
-// field flag like: `db:"name"`
-// more: github.com/jmoiron/sqlx
-func insertStruct(exec Execer, ctx context.Context, obj interface{}, tbName string, drvNames ...string) (sql.Result, error) {
+// build the 'name=?' list of fields joined by sep.
+func bindFields(d Dialect, fields []*reflectField, sep string) (string, []interface{}) {
+	stmts := make([]string, len(fields))
+	vals := make([]interface{}, len(fields))
+	for i, f := range fields {
+		stmts[i] = d.QuoteIdent(f.Name) + "=?"
+		vals[i] = f.Value.Interface()
+	}
+	return strings.Join(stmts, sep), vals
+}
+
+// return the driver name of exec, or the designated driver name, or the REFLECT_DRV_NAME.
+func reflectDrvName(exec interface{}, drvNames ...string) string {
 	drvName := REFLECT_DRV_NAME
-	db, ok := exec.(*DB)
+	db, ok := exec.(interface{ DriverName() string })
 	if ok {
 		drvName = db.DriverName()
 	} else {
 		drvNamesLen := len(drvNames)
 		if drvNamesLen > 0 {
-			if drvNamesLen != 0 {
+			if drvNamesLen != 1 {
 				panic(errors.New("'drvNames' expect only one argument").As(drvNames))
 			}
 			drvName = drvNames[0]
 		}
 	}
+	return drvName
+}
+
+// field flag like: `db:"name"`
+// more: github.com/jmoiron/sqlx
+func insertStruct(exec Execer, ctx context.Context, obj interface{}, tbName string, drvNames ...string) (sql.Result, error) {
+	drvName := reflectDrvName(exec, drvNames...)
+
+	fields, err := reflectInsertStruct(obj, drvName)
+	if err != nil {
+		return nil, withCause(errors.As(err), err)
+	}
+	result, err := execInsertRows(exec, ctx, GetDialect(drvName), tbName, []*reflectInsertField{fields})
+	if err != nil {
+		return nil, withCause(errors.As(err), err)
+	}
+	return result, nil
+}
+
+// the result of insert which fetch back the auto_increment by returning.
+type insertResult struct {
+	lastInsertId int64
+	rowsAffected int64
+}
+
+func (r *insertResult) LastInsertId() (int64, error) {
+	return r.lastInsertId, nil
+}
+func (r *insertResult) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+// build the insert sql with multi rows.
+func insertRowsSql(d Dialect, tbName string, rows [][]*reflectField, returning string) (string, []interface{}) {
+	names := make([]string, len(rows[0]))
+	for i, f := range rows[0] {
+		names[i] = f.Name
+	}
+	vals := make([]interface{}, 0, len(rows)*len(names))
+	for _, row := range rows {
+		for _, f := range row {
+			vals = append(vals, f.Value.Interface())
+		}
+	}
+	return rebind(d, d.InsertSql(tbName, names, len(rows), returning)), vals
+}
+
+// insert the rows of objs, and back-fill the auto_increment fields.
+// The auto_increment is fetched back by the returning clause when the dialect need it,
+// or else by the sql.Result.LastInsertId.
+func execInsertRows(exec Execer, ctx context.Context, d Dialect, tbName string, objs []*reflectInsertField) (sql.Result, error) {
+	if c, ok := exec.(*Cluster); ok {
+		// the returning clause is queried, and the query of cluster is sent to a replica.
+		exec = c.Primary()
+	}
+	rows := make([][]*reflectField, len(objs))
+	for i, obj := range objs {
+		rows[i], _ = obj.AutoIncrementFields()
+	}
+	_, autoField := objs[0].AutoIncrementFields()
+
+	returning := ""
+	if autoField != nil {
+		returning = d.ReturningClause(autoField.Name)
+	}
+	// a '?' in returning clause is an output argument, like the oracle 'RETURNING col INTO ?'.
+	isOutput := strings.Contains(returning, "?")
+	_, isSqlserver := d.(*sqlserverDialect)
+	if (isOutput || isSqlserver) && len(objs) > 1 {
+		// unsupport for multi rows, the output argument is for one row,
+		// and the order of the sqlserver OUTPUT rows is not guaranteed as the VALUES.
+		returning = ""
+	}
+	// the id can not be fetched back when the returning clause is not available.
+	backFill := autoField != nil && (len(returning) > 0 || d.ReturningClause(autoField.Name) == "")
+	if _, ok := exec.(Queryer); !ok && len(returning) > 0 && !isOutput {
+		// the returning clause need a Queryer, exec it without back-fill.
+		returning = ""
+		backFill = false
+	}
+	execSql, vals := insertRowsSql(d, tbName, rows, returning)
+
+	switch {
+	case len(returning) == 0:
+		result, err := execContext(exec, ctx, execSql, vals...)
+		if err != nil {
+			return nil, withCause(errors.As(err, execSql), err)
+		}
+		if !backFill {
+			return result, nil
+		}
+		firstId, ok := int64(0), len(objs) == 1
+		if !ok {
+			if _, ok = d.FirstInsertId(0, len(objs)); !ok {
+				// the driver can not report it.
+				return result, nil
+			}
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, withCause(errors.As(err, execSql), err)
+		}
+		firstId = id
+		if len(objs) > 1 {
+			firstId, _ = d.FirstInsertId(id, len(objs))
+		}
+		for i, obj := range objs {
+			obj.SetAutoIncrementId(firstId + int64(i))
+		}
+		return result, nil
+
+	case isOutput:
+		id := int64(0)
+		vals = append(vals, sql.Out{Dest: &id})
+		_, err := execContext(exec, ctx, execSql, vals...)
+		if err != nil {
+			return nil, withCause(errors.As(err, execSql), err)
+		}
+		objs[0].SetAutoIncrementId(id)
+		return &insertResult{lastInsertId: id, rowsAffected: 1}, nil
+
+	default:
+		queryer := exec.(Queryer)
+		r := &insertResult{}
+		if err := withHooks(exec, ctx, HOOK_OP_EXEC, execSql, vals, func(ctx context.Context) (int64, error) {
+			result, err := queryer.QueryContext(ctx, execSql, vals...)
+			if err != nil {
+				return -1, err
+			}
+			defer Close(result)
+			for result.Next() {
+				if err := result.Scan(&r.lastInsertId); err != nil {
+					return -1, err
+				}
+				if r.rowsAffected < int64(len(objs)) {
+					objs[r.rowsAffected].SetAutoIncrementId(r.lastInsertId)
+				}
+				r.rowsAffected++
+			}
+			return r.rowsAffected, result.Err()
+		}); err != nil {
+			return nil, withCause(errors.As(err, execSql), err)
+		}
+		return r, nil
+	}
+}
+
+// obj is a slice of struct or struct pointer.
+func insertStructs(exec Execer, ctx context.Context, obj interface{}, tbName string, drvNames ...string) ([]sql.Result, error) {
+	drvName := reflectDrvName(exec, drvNames...)
+	d := GetDialect(drvName)
+
+	value := reflect.Indirect(reflect.ValueOf(obj))
+	if value.Kind() != reflect.Slice {
+		return nil, errors.New("Unsupport reflect type").As(value.Kind().String())
+	}
+	objLen := value.Len()
+	if objLen == 0 {
+		return []sql.Result{}, nil
+	}
+
+	objFields := make([]*reflectInsertField, objLen)
+	for i := 0; i < objLen; i++ {
+		item := value.Index(i)
+		if item.Kind() == reflect.Interface {
+			item = item.Elem()
+		}
+		if !item.IsValid() || (item.Kind() == reflect.Ptr && item.IsNil()) {
+			return nil, errors.New("Nil element").As(i)
+		}
+		if item.Kind() != reflect.Ptr {
+			item = item.Addr()
+		}
+		fields, err := reflectInsertStruct(item.Interface(), drvName)
+		if err != nil {
+			return nil, withCause(errors.As(err, i), err)
+		}
+		if i > 0 && fields.Names != objFields[0].Names {
+			return nil, errors.New("Fields not match").As(i, objFields[0].Names, fields.Names)
+		}
+		objFields[i] = fields
+	}
+	columns := len(objFields[0].Values)
+
+	maxParams, maxRows := d.MaxParams()
+	chunkSize := maxParams / columns
+	if chunkSize == 0 {
+		chunkSize = 1
+	}
+	if maxRows > 0 && chunkSize > maxRows {
+		chunkSize = maxRows
+	}
+
+	results := []sql.Result{}
+	for start := 0; start < objLen; start += chunkSize {
+		end := start + chunkSize
+		if end > objLen {
+			end = objLen
+		}
+		result, err := execInsertRows(exec, ctx, d, tbName, objFields[start:end])
+		if err != nil {
+			return results, withCause(errors.As(err), err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// key field flag like: `db:"id,pk"`, the auto_increment field is a key field too.
+func updateStruct(exec Execer, ctx context.Context, obj interface{}, tbName string, drvNames ...string) (sql.Result, error) {
+	drvName := reflectDrvName(exec, drvNames...)
+
+	fields, err := reflectInsertStruct(obj, drvName)
+	if err != nil {
+		return nil, withCause(errors.As(err), err)
+	}
+	data, keys := fields.KeyFields()
+	if len(keys) == 0 {
+		return nil, errors.New("No key field found").As(tbName)
+	}
+	if len(data) == 0 {
+		return nil, errors.New("No field to update").As(tbName)
+	}
+
+	d := GetDialect(drvName)
+	sets, vals := bindFields(d, data, ",")
+	wheres, keyVals := bindFields(d, keys, " AND ")
+	vals = append(vals, keyVals...)
+
+	execSql := rebind(d, fmt.Sprintf(updateObjSql, tbName, sets, wheres))
+	result, err := execContext(exec, ctx, execSql, vals...)
+	if err != nil {
+		return nil, withCause(errors.As(err, execSql), err)
+	}
+	return result, nil
+}
+
+// key field flag like: `db:"id,pk"`, the auto_increment field is a key field too.
+func deleteStruct(exec Execer, ctx context.Context, obj interface{}, tbName string, drvNames ...string) (sql.Result, error) {
+	drvName := reflectDrvName(exec, drvNames...)
+
+	fields, err := reflectInsertStruct(obj, drvName)
+	if err != nil {
+		return nil, withCause(errors.As(err), err)
+	}
+	_, keys := fields.KeyFields()
+	if len(keys) == 0 {
+		return nil, errors.New("No key field found").As(tbName)
+	}
+	return deleteByFields(exec, ctx, drvName, tbName, keys)
+}
+
+func deleteByKey(exec Execer, ctx context.Context, tbName string, keys map[string]interface{}, drvNames ...string) (sql.Result, error) {
+	drvName := reflectDrvName(exec, drvNames...)
+	if len(keys) == 0 {
+		return nil, errors.New("No key field found").As(tbName)
+	}
+
+	// sort the names to make a stable sql
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fields := make([]*reflectField, len(names))
+	for i, name := range names {
+		val := keys[name]
+		fields[i] = &reflectField{Name: name, Value: reflect.ValueOf(&val).Elem()}
+	}
+	return deleteByFields(exec, ctx, drvName, tbName, fields)
+}
+
+func deleteByFields(exec Execer, ctx context.Context, drvName, tbName string, keys []*reflectField) (sql.Result, error) {
+	d := GetDialect(drvName)
+	wheres, vals := bindFields(d, keys, " AND ")
+	execSql := rebind(d, fmt.Sprintf(deleteObjSql, tbName, wheres))
+	result, err := execContext(exec, ctx, execSql, vals...)
+	if err != nil {
+		return nil, withCause(errors.As(err, execSql), err)
+	}
+	return result, nil
+}
+
+// conflict key field flag like: `db:"id,pk"` or `db:"name,unique"`.
+func upsertStruct(exec Execer, ctx context.Context, obj interface{}, tbName string, drvNames ...string) (sql.Result, error) {
+	drvName := reflectDrvName(exec, drvNames...)
 
 	fields, err := reflectInsertStruct(obj, drvName)
 	if err != nil {
-		return nil, errors.As(err)
+		return nil, withCause(errors.As(err), err)
+	}
+	data, keys := fields.ConflictFields()
+	if len(keys) == 0 {
+		return nil, errors.New("No conflict key field found, mark it with `pk` or `unique`, or set the value of auto_increment field").As(tbName)
+	}
+	isKey := map[*reflectField]bool{}
+	keyNames := make([]string, len(keys))
+	for i, f := range keys {
+		isKey[f] = true
+		keyNames[i] = f.Name
+	}
+	names := make([]string, len(data))
+	updates := []string{}
+	vals := make([]interface{}, len(data))
+	for i, f := range data {
+		names[i] = f.Name
+		if !isKey[f] {
+			updates = append(updates, f.Name)
+		}
+		vals[i] = f.Value.Interface()
 	}
-	execSql := fmt.Sprintf(addObjSql, tbName, fields.Names, fields.Stmts)
-	// log.Debugf("%s%+v", execSql, vals)
-	result, err := exec.ExecContext(ctx, execSql, fields.Values...)
+
+	d := GetDialect(drvName)
+	execSql := rebind(d, d.UpsertSql(tbName, names, keyNames, updates))
+	result, err := execContext(exec, ctx, execSql, vals...)
 	if err != nil {
-		return nil, errors.As(err, execSql)
-	}
-	if fields.AutoIncrement != nil {
-		id, _ := result.LastInsertId()
-		var val reflect.Value
-		kind := fields.AutoIncrement.Kind()
-		switch kind {
-		case reflect.Int:
-			val = reflect.ValueOf(int(id))
-		case reflect.Int8:
-			val = reflect.ValueOf(int8(id))
-		case reflect.Int16:
-			val = reflect.ValueOf(int16(id))
-		case reflect.Int32:
-			val = reflect.ValueOf(int32(id))
-		case reflect.Int64:
-			val = reflect.ValueOf(int64(id))
-		case reflect.Uint: // Warnning: this maybe out of int64
-			val = reflect.ValueOf(uint(id))
-		case reflect.Uint8:
-			val = reflect.ValueOf(uint8(id))
-		case reflect.Uint16:
-			val = reflect.ValueOf(uint16(id))
-		case reflect.Uint32:
-			val = reflect.ValueOf(uint32(id))
-		case reflect.Uint64: // Warnning: this maybe out of int64
-			val = reflect.ValueOf(uint64(id))
-		default:
-			// unsupport other kind here
-			panic("unsupport auto increment kind: " + kind.String())
-		}
-
-		fields.AutoIncrement.Set(val)
+		return nil, withCause(errors.As(err, execSql), err)
 	}
 	return result, nil
 }
 
-func execMultiTx(tx *sql.Tx, ctx context.Context, mTx []*MultiTx) error {
+func execMultiTx(tx Execer, ctx context.Context, mTx []*MultiTx) error {
 	for _, mt := range mTx {
-		if _, err := tx.ExecContext(ctx, mt.Query, mt.Args...); err != nil {
-			return errors.As(err)
+		if _, err := execContext(tx, ctx, mt.Query, mt.Args...); err != nil {
+			return withCause(errors.As(err), err)
 		}
 	}
 	return nil
 }
 
+func execMultiTxResults(tx Execer, ctx context.Context, mTx []*MultiTx) ([]sql.Result, error) {
+	results := make([]sql.Result, 0, len(mTx))
+	for i, mt := range mTx {
+		result, err := execContext(tx, ctx, mt.Query, mt.Args...)
+		if err != nil {
+			return results, &MultiTxError{Index: i, Query: mt.Query, Err: err}
+		}
+		if mt.checkRows {
+			rows, err := result.RowsAffected()
+			if err != nil {
+				return results, &MultiTxError{Index: i, Query: mt.Query, Err: err}
+			}
+			if rows != mt.expectRows {
+				return results, &MultiTxError{Index: i, Query: mt.Query, Err: &RowsAffectedError{Expect: mt.expectRows, Actual: rows}}
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
 // fieldsByName fills a values interface with fields from the passed value based
 // on the traversals in int.  If ptrs is true, return addresses instead of values.
 // We write this instead of using FieldsByName to save allocations and map lookups
@@ -133,7 +486,7 @@ func scanStruct(rows Rows, obj interface{}) error {
 
 	columns, err := rows.Columns()
 	if err != nil {
-		return errors.As(err)
+		return withCause(errors.As(err), err)
 	}
 
 	fields := refxM.TraversalsByName(base, columns)
@@ -144,13 +497,13 @@ func scanStruct(rows Rows, obj interface{}) error {
 	vp := reflect.New(base)
 	v := reflect.Indirect(vp)
 	if err := fieldsByTraversal(v, fields, values, true); err != nil {
-		return errors.As(err)
+		return withCause(errors.As(err), err)
 	}
 	if !rows.Next() {
 		return sql.ErrNoRows
 	}
 	if err := rows.Scan(values...); err != nil {
-		return errors.As(err)
+		return withCause(errors.As(err), err)
 	}
 	direct.Set(v)
 	return nil
@@ -171,7 +524,7 @@ func scanStructs(rows Rows, obj interface{}) error {
 
 	columns, err := rows.Columns()
 	if err != nil {
-		return errors.As(err)
+		return withCause(errors.As(err), err)
 	}
 	fields := refxM.TraversalsByName(base, columns)
 	direct := reflect.Indirect(value)
@@ -182,11 +535,11 @@ func scanStructs(rows Rows, obj interface{}) error {
 		vp = reflect.New(base)
 		v = reflect.Indirect(vp)
 		if err := fieldsByTraversal(v, fields, values, true); err != nil {
-			return errors.As(err)
+			return withCause(errors.As(err), err)
 		}
 
 		if err := rows.Scan(values...); err != nil {
-			return errors.As(err)
+			return withCause(errors.As(err), err)
 		}
 		if isPtr {
 			direct.Set(reflect.Append(direct, vp))
@@ -198,41 +551,63 @@ func scanStructs(rows Rows, obj interface{}) error {
 	return nil
 }
 
-func queryStruct(db Queryer, ctx context.Context, obj interface{}, querySql string, args ...interface{}) error {
-	rows, err := db.QueryContext(ctx, querySql, args...)
-	if err != nil {
-		return errors.As(err, args)
+// return the length of slice which the obj points to, -1 if it is not a slice.
+func sliceLen(obj interface{}) int64 {
+	v := reflect.ValueOf(obj)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
 	}
-	defer Close(rows)
-
-	if err := scanStruct(rows, obj); err != nil {
-		return errors.As(err, args)
+	if v.Kind() != reflect.Slice {
+		return -1
 	}
-	return nil
+	return int64(v.Len())
 }
 
-func queryStructs(db Queryer, ctx context.Context, obj interface{}, querySql string, args ...interface{}) error {
-	rows, err := db.QueryContext(ctx, querySql, args...)
-	if err != nil {
-		return errors.As(err, args)
-	}
-	defer Close(rows)
+func queryStruct(db Queryer, ctx context.Context, obj interface{}, querySql string, args ...interface{}) error {
+	db = routeQuery(db, ctx)
+	return withHooks(db, ctx, HOOK_OP_QUERY, querySql, args, func(ctx context.Context) (int64, error) {
+		rows, err := db.QueryContext(ctx, querySql, args...)
+		if err != nil {
+			return -1, withCause(errors.As(err, redactArgs(args)), err)
+		}
+		defer Close(rows)
 
-	if err := scanStructs(rows, obj); err != nil {
-		return errors.As(err, args)
-	}
+		if err := scanStruct(rows, obj); err != nil {
+			return -1, withCause(errors.As(err, redactArgs(args)), err)
+		}
+		return 1, nil
+	})
+}
 
-	return nil
+func queryStructs(db Queryer, ctx context.Context, obj interface{}, querySql string, args ...interface{}) error {
+	db = routeQuery(db, ctx)
+	return withHooks(db, ctx, HOOK_OP_QUERY, querySql, args, func(ctx context.Context) (int64, error) {
+		rows, err := db.QueryContext(ctx, querySql, args...)
+		if err != nil {
+			return -1, withCause(errors.As(err, redactArgs(args)), err)
+		}
+		defer Close(rows)
+
+		// the rows are appended to the slice, so count the scanned by the length changed.
+		before := sliceLen(obj)
+		if err := scanStructs(rows, obj); err != nil {
+			return -1, withCause(errors.As(err, redactArgs(args)), err)
+		}
+		return sliceLen(obj) - before, nil
+	})
 }
 
 func queryElem(db Queryer, ctx context.Context, result interface{}, querySql string, args ...interface{}) error {
-	if err := db.QueryRowContext(ctx, querySql, args...).Scan(result); err != nil {
-		if sql.ErrNoRows != err {
-			return errors.As(err, querySql, args)
+	db = routeQuery(db, ctx)
+	return withHooks(db, ctx, HOOK_OP_QUERY, querySql, args, func(ctx context.Context) (int64, error) {
+		if err := db.QueryRowContext(ctx, querySql, args...).Scan(result); err != nil {
+			if sql.ErrNoRows != err {
+				return -1, withCause(errors.As(err, querySql, redactArgs(args)), err)
+			}
+			return 0, err
 		}
-		return err
-	}
-	return nil
+		return 1, nil
+	})
 }
 
 func queryElems(db Queryer, ctx context.Context, arr interface{}, querySql string, args ...interface{}) error {
@@ -249,27 +624,31 @@ func queryElems(db Queryer, ctx context.Context, arr interface{}, querySql strin
 	}
 	base := reflectx.Deref(slice.Elem())
 
-	rows, err := db.QueryContext(ctx, querySql, args...)
-	if err != nil {
-		return errors.As(err, querySql, args)
-	}
-	defer Close(rows)
-
-	isPtr := slice.Elem().Kind() == reflect.Ptr
-	direct := reflect.Indirect(value)
-	var vp reflect.Value
-	for rows.Next() {
-		vp = reflect.New(base)
-		if err := rows.Scan(vp.Interface()); err != nil {
-			return errors.As(err)
+	db = routeQuery(db, ctx)
+	return withHooks(db, ctx, HOOK_OP_QUERY, querySql, args, func(ctx context.Context) (int64, error) {
+		rows, err := db.QueryContext(ctx, querySql, args...)
+		if err != nil {
+			return -1, withCause(errors.As(err, querySql, redactArgs(args)), err)
 		}
-		if isPtr {
-			direct.Set(reflect.Append(direct, vp))
-		} else {
-			direct.Set(reflect.Append(direct, reflect.Indirect(vp)))
+		defer Close(rows)
+
+		isPtr := slice.Elem().Kind() == reflect.Ptr
+		direct := reflect.Indirect(value)
+		before := direct.Len()
+		var vp reflect.Value
+		for rows.Next() {
+			vp = reflect.New(base)
+			if err := rows.Scan(vp.Interface()); err != nil {
+				return -1, withCause(errors.As(err), err)
+			}
+			if isPtr {
+				direct.Set(reflect.Append(direct, vp))
+			} else {
+				direct.Set(reflect.Append(direct, reflect.Indirect(vp)))
+			}
 		}
-	}
-	return nil
+		return int64(direct.Len() - before), nil
+	})
 }
 
 // 执行一个通用的查询
@@ -278,58 +657,67 @@ func queryElems(db Queryer, ctx context.Context, arr interface{}, querySql strin
 func queryPageArr(db Queryer, ctx context.Context, querySql string, args ...interface{}) (titles []string, result [][]interface{}, err error) {
 	titles = []string{}
 	result = [][]interface{}{}
-	rows, err := db.QueryContext(ctx, querySql, args...)
-	if err != nil {
-		return titles, result, errors.As(err, args)
-	}
-	defer Close(rows)
-
-	titles, err = rows.Columns()
-	if err != nil {
-		return titles, result, errors.As(err, args)
-	}
+	db = routeQuery(db, ctx)
+	err = withHooks(db, ctx, HOOK_OP_QUERY, querySql, args, func(ctx context.Context) (int64, error) {
+		rows, err := db.QueryContext(ctx, querySql, args...)
+		if err != nil {
+			return -1, withCause(errors.As(err, redactArgs(args)), err)
+		}
+		defer Close(rows)
 
-	for rows.Next() {
-		r := makeDBData(len(titles))
-		if err := rows.Scan(r...); err != nil {
-			return titles, result, errors.As(err, args)
+		titles, err = rows.Columns()
+		if err != nil {
+			return -1, withCause(errors.As(err, redactArgs(args)), err)
 		}
-		result = append(result, r)
-	}
 
-	return titles, result, nil
+		for rows.Next() {
+			r := makeDBData(len(titles))
+			if err := rows.Scan(r...); err != nil {
+				return -1, withCause(errors.As(err, redactArgs(args)), err)
+			}
+			result = append(result, r)
+		}
+		return int64(len(result)), nil
+	})
+	return titles, result, err
 }
 
 // 查询一条数据，并发map结构返回，以便页面可以直接调用
 // 因需要查标题，相对标准sql会慢一些，适用于偷懒查询的方式
 // 即使发生错误返回至少是零长度的值
 func queryPageMap(db Queryer, ctx context.Context, querySql string, args ...interface{}) ([]string, []map[string]interface{}, error) {
-	rows, err := db.QueryContext(ctx, querySql, args...)
-	if err != nil {
-		return nil, []map[string]interface{}{}, errors.As(err, args)
-	}
-	defer Close(rows)
+	var titles []string
+	result := []map[string]interface{}{}
+	db = routeQuery(db, ctx)
+	err := withHooks(db, ctx, HOOK_OP_QUERY, querySql, args, func(ctx context.Context) (int64, error) {
+		rows, err := db.QueryContext(ctx, querySql, args...)
+		if err != nil {
+			return -1, withCause(errors.As(err, redactArgs(args)), err)
+		}
+		defer Close(rows)
 
-	titles, err := rows.Columns()
-	if err != nil {
-		return titles, []map[string]interface{}{}, errors.As(err, args)
-	}
+		titles, err = rows.Columns()
+		if err != nil {
+			return -1, withCause(errors.As(err, redactArgs(args)), err)
+		}
 
-	result := []map[string]interface{}{}
-	for rows.Next() {
-		r := makeDBData(len(titles))
-		if err := rows.Scan(r...); err != nil {
-			return titles, []map[string]interface{}{}, errors.As(err, args)
-		}
-		mData := map[string]interface{}{}
-		for i, name := range titles {
-			_, ok := mData[name]
-			if ok {
-				return titles, result, errors.New("Already exist column name").As(name)
+		for rows.Next() {
+			r := makeDBData(len(titles))
+			if err := rows.Scan(r...); err != nil {
+				result = []map[string]interface{}{}
+				return -1, withCause(errors.As(err, redactArgs(args)), err)
 			}
-			mData[name] = r[i]
+			mData := map[string]interface{}{}
+			for i, name := range titles {
+				_, ok := mData[name]
+				if ok {
+					return -1, errors.New("Already exist column name").As(name)
+				}
+				mData[name] = r[i]
+			}
+			result = append(result, mData)
 		}
-		result = append(result, mData)
-	}
-	return titles, result, nil
+		return int64(len(result)), nil
+	})
+	return titles, result, err
 }
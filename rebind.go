@@ -0,0 +1,99 @@
+package database
+
+import (
+	"strings"
+)
+
+// convert the '?' bind variables of query to the dialect bind style.
+// The '?' in string literals, quoted identifiers and comments are kept.
+func rebind(d Dialect, query string) string {
+	if d.Placeholder(1) == "?" {
+		return query
+	}
+	bracketQuote := d.QuoteIdent("") == "[]"
+
+	buf := &strings.Builder{}
+	buf.Grow(len(query) + 16)
+	n := 0
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		end := i
+		switch c {
+		case '?':
+			n++
+			buf.WriteString(d.Placeholder(n))
+			continue
+		case '\'', '"', '`':
+			end = quoteEnd(query, i+1, c)
+		case '[':
+			if bracketQuote {
+				end = quoteEnd(query, i+1, ']')
+			}
+		case '-':
+			if strings.HasPrefix(query[i:], "--") {
+				end = strings.IndexByte(query[i:], '\n')
+				if end < 0 {
+					end = len(query)
+				} else {
+					end += i
+				}
+			}
+		case '/':
+			if strings.HasPrefix(query[i:], "/*") {
+				end = strings.Index(query[i+2:], "*/")
+				if end < 0 {
+					end = len(query)
+				} else {
+					end += i + 3
+				}
+			}
+		case '$':
+			// the dollar-quoted string of postgres, like $$...$$ or $tag$...$tag$
+			if tag := dollarTag(query[i:]); len(tag) > 0 {
+				end = strings.Index(query[i+len(tag):], tag)
+				if end < 0 {
+					end = len(query)
+				} else {
+					end += i + 2*len(tag) - 1
+				}
+			}
+		}
+		if end >= len(query) {
+			end = len(query) - 1
+		}
+		buf.WriteString(query[i : end+1])
+		i = end
+	}
+	return buf.String()
+}
+
+// return the index of the close quote, the doubled quote is taken as an escape.
+func quoteEnd(query string, start int, quote byte) int {
+	for j := start; j < len(query); j++ {
+		if query[j] != quote {
+			continue
+		}
+		if j+1 < len(query) && query[j+1] == quote {
+			j++
+			continue
+		}
+		return j
+	}
+	return len(query)
+}
+
+// return the tag like $$ or $tag$ at the begin of s, or empty if not a dollar-quoted tag.
+func dollarTag(s string) string {
+	for j := 1; j < len(s); j++ {
+		c := s[j]
+		switch {
+		case c == '$':
+			return s[:j+1]
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= 0x80:
+		case c >= '0' && c <= '9' && j > 1:
+		default:
+			return ""
+		}
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"database/sql/driver"
+	"testing"
+)
+
+func TestRebind(t *testing.T) {
+	query := `SELECT a, '?', "b?", /* ? */ c FROM t WHERE a=? AND b=? -- ?
+AND c=?`
+	cases := []struct {
+		drvName string
+		query   string
+		expect  string
+	}{
+		{DRV_NAME_MYSQL, query, query},
+		{DRV_NAME_SQLITE3, query, query},
+		{DRV_NAME_POSTGRES, query, `SELECT a, '?', "b?", /* ? */ c FROM t WHERE a=$1 AND b=$2 -- ?
+AND c=$3`},
+		{DRV_NAME_ORACLE, query, `SELECT a, '?', "b?", /* ? */ c FROM t WHERE a=:1 AND b=:2 -- ?
+AND c=:3`},
+		{DRV_NAME_SQLSERVER, query, `SELECT a, '?', "b?", /* ? */ c FROM t WHERE a=@p1 AND b=@p2 -- ?
+AND c=@p3`},
+		{"pgx", "SELECT 'it''s ?', ? FROM t", "SELECT 'it''s ?', $1 FROM t"},
+		{DRV_NAME_POSTGRES, "SELECT $$?$$, $tag$ ? $tag$, ?", "SELECT $$?$$, $tag$ ? $tag$, $1"},
+		{DRV_NAME_POSTGRES, "SELECT a[?] FROM t WHERE b=$1", "SELECT a[$1] FROM t WHERE b=$1"},
+		{DRV_NAME_SQLSERVER, "SELECT [a?] FROM t WHERE b=?", "SELECT [a?] FROM t WHERE b=@p1"},
+		{DRV_NAME_ORACLE, "SELECT '?", "SELECT '?"},
+	}
+	for i, c := range cases {
+		if got := Rebind(c.drvName, c.query); got != c.expect {
+			t.Fatalf("case %d %s: %s", i, c.drvName, got)
+		}
+	}
+}
+
+func TestInsertStructRebind(t *testing.T) {
+	cases := []struct {
+		drvName string
+		expect  string
+	}{
+		{DRV_NAME_MYSQL, "INSERT INTO testing (`a`,`time`,`data`,`byte`,`dbdata`,`null_string`,`C`,`d`,`id`,`a`,`C`,`e`) VALUES (?,?,?,?,?,?,?,?,?,?,?,?);"},
+		{DRV_NAME_SQLITE3, `INSERT INTO testing ("a","time","data","byte","dbdata","null_string","C","d","id","a","C","e") VALUES (?,?,?,?,?,?,?,?,?,?,?,?);`},
+		{DRV_NAME_POSTGRES, `INSERT INTO testing ("a","time","data","byte","dbdata","null_string","C","d","id","a","C","e") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12) RETURNING "id";`},
+		{DRV_NAME_ORACLE, `INSERT INTO testing ("a","time","data","byte","dbdata","null_string","C","d","id","a","C","e") VALUES (:1,:2,:3,:4,:5,:6,:7,:8,:9,:10,:11,:12) RETURNING "id" INTO :13`},
+		{DRV_NAME_SQLSERVER, `INSERT INTO testing ([a],[time],[data],[byte],[dbdata],[null_string],[C],[d],[id],[a],[C],[e]) OUTPUT INSERTED.[id] VALUES (@p1,@p2,@p3,@p4,@p5,@p6,@p7,@p8,@p9,@p10,@p11,@p12);`},
+	}
+	for _, c := range cases {
+		db, drv := newTestDB(c.drvName, func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+			return []string{"id"}, [][]driver.Value{{int64(1)}}, nil
+		})
+		obj := &ReflectTestStruct4{
+			ReflectTestStruct2: &ReflectTestStruct2{},
+		}
+		if _, err := InsertStruct(db, obj, "testing"); err != nil {
+			t.Fatal(err)
+		}
+		if drv.LastQuery() != c.expect {
+			t.Fatalf("%s: %s", c.drvName, drv.LastQuery())
+		}
+		if obj.ReflectTestStruct3.Id != 1 {
+			t.Fatalf("%s: expect auto_increment back-filled", c.drvName)
+		}
+	}
+}
+
+func TestInsertStructExecer(t *testing.T) {
+	// the returning clause need a Queryer, an Execer inserts without back-fill.
+	exec := &testExecer{}
+	obj := &ReflectTestStruct6{Name: "a", Age: 1}
+	if _, err := InsertStruct(exec, obj, "testing", DRV_NAME_POSTGRES); err != nil {
+		t.Fatal(err)
+	}
+	if exec.query != `INSERT INTO testing ("name","age") VALUES ($1,$2);` {
+		t.Fatal(exec.query)
+	}
+	if obj.Id != 0 {
+		t.Fatal(obj.Id)
+	}
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// The modes of the query args annotated in the errors.
+const (
+	ARGS_MODE_PLAIN    = 0 // annotate the args as it is, except the Sensitive args.
+	ARGS_MODE_TRUNCATE = 1 // truncate the args longer than ARGS_TRUNCATE_LEN.
+	ARGS_MODE_REDACT   = 2 // mask all the args.
+)
+
+var (
+	// The mode of the query args annotated in the errors, default is ARGS_MODE_PLAIN.
+	// For example:
+	// func init(){
+	//     database.ARGS_MODE = database.ARGS_MODE_REDACT
+	// }
+	ARGS_MODE = ARGS_MODE_PLAIN
+
+	// The max length of an arg in the ARGS_MODE_TRUNCATE mode.
+	ARGS_TRUNCATE_LEN = 64
+)
+
+// the arg is passed to driver as it is, but masked in the errors and logs.
+type sensitiveArg struct {
+	arg interface{}
+}
+
+// implement the driver.Valuer
+func (s sensitiveArg) Value() (driver.Value, error) {
+	if v, ok := s.arg.(driver.Valuer); ok {
+		return v.Value()
+	}
+	return driver.DefaultParameterConverter.ConvertValue(s.arg)
+}
+
+// implement the fmt.Stringer
+func (s sensitiveArg) String() string {
+	return redactedPassword
+}
+
+// implement the fmt.GoStringer
+func (s sensitiveArg) GoString() string {
+	return redactedPassword
+}
+
+func redactArgs(args []interface{}) []interface{} {
+	result := make([]interface{}, len(args))
+	for i, arg := range args {
+		if _, ok := arg.(sensitiveArg); ok {
+			result[i] = redactedPassword
+			continue
+		}
+		switch ARGS_MODE {
+		case ARGS_MODE_REDACT:
+			result[i] = redactedPassword
+		case ARGS_MODE_TRUNCATE:
+			s := fmt.Sprintf("%v", arg)
+			if b, ok := arg.([]byte); ok {
+				s = string(b)
+			}
+			if ARGS_TRUNCATE_LEN >= 0 && len(s) > ARGS_TRUNCATE_LEN {
+				s = s[:ARGS_TRUNCATE_LEN] + "..."
+			}
+			result[i] = s
+		default:
+			result[i] = arg
+		}
+	}
+	return result
+}
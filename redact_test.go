@@ -0,0 +1,42 @@
+package database
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRedactArgs(t *testing.T) {
+	mdb, drv := newTestDB("mysql", func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		return nil, nil, errors.New("query failed")
+	})
+	defer mdb.Close()
+
+	err := QueryElem(mdb, new(int), "SELECT 1 FROM user WHERE name=? AND passwd=?", "alice", Sensitive("secret"))
+	if err == nil {
+		t.Fatal("expect error")
+	}
+	if strings.Contains(err.Error(), "secret") || !strings.Contains(err.Error(), "alice") {
+		t.Fatal(err)
+	}
+	drv.mu.Lock()
+	arg := drv.args[len(drv.args)-1][1].Value
+	drv.mu.Unlock()
+	if v, err := arg.(driver.Valuer).Value(); err != nil || v != "secret" {
+		t.Fatal(v, err)
+	}
+
+	defer func(mode int) { ARGS_MODE = mode }(ARGS_MODE)
+	ARGS_MODE = ARGS_MODE_REDACT
+	err = QueryElem(mdb, new(int), "SELECT 1 FROM user WHERE name=?", "alice")
+	if err == nil || strings.Contains(err.Error(), "alice") {
+		t.Fatal(err)
+	}
+
+	ARGS_MODE = ARGS_MODE_TRUNCATE
+	args := RedactArgs(strings.Repeat("a", ARGS_TRUNCATE_LEN+10), []byte("bytes"), 1, Sensitive(2))
+	if args[0] != strings.Repeat("a", ARGS_TRUNCATE_LEN)+"..." || args[1] != "bytes" || args[2] != "1" || args[3] != "***" {
+		t.Fatal(args)
+	}
+}
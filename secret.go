@@ -0,0 +1,100 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gwaylib/errors"
+)
+
+// Resolve the secret reference of a scheme to the value, the ref is the text after 'scheme:'.
+type SecretResolver func(ref string) (string, error)
+
+var (
+	secretLock      = sync.RWMutex{}
+	secretResolvers = map[string]SecretResolver{
+		"env":  resolveEnvSecret,
+		"file": resolveFileSecret,
+	}
+)
+
+// Register a secret resolver for the scheme, it will replace the old one if exists.
+// The dsn and password of config can reference a secret by '${scheme:ref}', for example:
+//
+//	${env:DB_PASS}
+//	${file:///run/secrets/db_pass}
+//
+// The 'env' and 'file' schemes are builtin, and the '$VAR' or '${VAR}' is expanded by the environment.
+func RegisterSecretResolver(scheme string, fn SecretResolver) {
+	secretLock.Lock()
+	defer secretLock.Unlock()
+	secretResolvers[scheme] = fn
+}
+
+func getSecretResolver(scheme string) (SecretResolver, bool) {
+	secretLock.RLock()
+	defer secretLock.RUnlock()
+	fn, ok := secretResolvers[scheme]
+	return fn, ok
+}
+
+func resolveEnvSecret(ref string) (string, error) {
+	val, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", errors.New("env not found").As(ref)
+	}
+	return val, nil
+}
+
+// return the file name of the 'file' secret ref.
+func secretFileName(ref string) string {
+	return strings.TrimPrefix(ref, "//")
+}
+
+// read the secret from file, the ref can be 'file:///path' or 'file:path'.
+func resolveFileSecret(ref string) (string, error) {
+	fileName := secretFileName(ref)
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return "", errors.As(err, fileName)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// expand the '${scheme:ref}' by the secret resolvers, and the others by the environment,
+// the file names of the 'file' scheme are appended to files.
+// The secret value is not included in the returned error.
+func expandSecrets(s string, files *[]string) (string, error) {
+	var resolveErr error
+	result := os.Expand(s, func(name string) string {
+		idx := strings.Index(name, ":")
+		if idx < 0 {
+			return os.Getenv(name)
+		}
+		scheme := name[:idx]
+		fn, ok := getSecretResolver(scheme)
+		if !ok {
+			if resolveErr == nil {
+				resolveErr = errors.New("secret resolver not found").As(scheme)
+			}
+			return ""
+		}
+		if scheme == "file" {
+			*files = append(*files, secretFileName(name[idx+1:]))
+		}
+		val, err := fn(name[idx+1:])
+		if err != nil {
+			if resolveErr == nil {
+				resolveErr = errors.As(err, scheme)
+			}
+			return ""
+		}
+		return val
+	})
+	if resolveErr != nil {
+		return "", resolveErr
+	}
+	return result, nil
+}
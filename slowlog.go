@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gwaylib/log"
+)
+
+// the default max slow logs per second.
+const defaultSlowLogRate = 10
+
+// the source dir of this package, it is skipped when finding the caller.
+var pkgDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}()
+
+// The hook logs the query and exec slower than the threshold,
+// with the caller file:line, redacted args, duration and rows.
+// It is added to the db opened from the config which 'slow_threshold' is set.
+type SlowQueryHook struct {
+	NopHook
+
+	threshold time.Duration
+	rate      int
+
+	// the output of logs, default is log.Warnf of github.com/gwaylib/log.
+	Logf func(format string, args ...interface{})
+
+	mu         sync.Mutex
+	window     time.Time
+	logged     int
+	suppressed int
+}
+
+// Make a slow query hook, the logs are limited by the rate per second to avoid flooding, 0 is unlimited.
+func NewSlowQueryHook(threshold time.Duration, rate int) *SlowQueryHook {
+	return &SlowQueryHook{threshold: threshold, rate: rate, Logf: log.Warnf}
+}
+
+func (h *SlowQueryHook) AfterQuery(ctx context.Context, e *HookEvent) {
+	h.after(e)
+}
+
+func (h *SlowQueryHook) AfterExec(ctx context.Context, e *HookEvent) {
+	h.after(e)
+}
+
+func (h *SlowQueryHook) after(e *HookEvent) {
+	if e.Duration < h.threshold {
+		return
+	}
+	suppressed, ok := h.sample(time.Now())
+	if !ok {
+		return
+	}
+	msg := fmt.Sprintf("slow %s %s at %s, rows:%d, query:%s, args:%v", e.Op, e.Duration, slowCaller(), e.Rows, e.Query, redactArgs(e.Args))
+	if e.Err != nil {
+		msg += ", err:" + e.Err.Error()
+	}
+	if suppressed > 0 {
+		msg += fmt.Sprintf(", %d suppressed", suppressed)
+	}
+	h.Logf("%s", msg)
+}
+
+// return true if the log is allowed in the window of now,
+// and the count of logs suppressed in the last window.
+func (h *SlowQueryHook) sample(now time.Time) (int, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.rate <= 0 {
+		return 0, true
+	}
+	suppressed := 0
+	if now.Sub(h.window) >= time.Second {
+		suppressed = h.suppressed
+		h.window = now
+		h.logged = 0
+		h.suppressed = 0
+	}
+	if h.logged >= h.rate {
+		h.suppressed++
+		return 0, false
+	}
+	h.logged++
+	return suppressed, true
+}
+
+// return the file:line which calls this package.
+func slowCaller() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if filepath.Dir(frame.File) != pkgDir || strings.HasSuffix(frame.File, "_test.go") {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowQueryHook(t *testing.T) {
+	fileName := writeTestIni(t, `
+[master]
+driver: testdb
+dsn: master
+slow_threshold: 1ns
+slow_log_rate: 1
+`)
+	defer os.Remove(fileName)
+	r := NewRegistry()
+	defer r.Close()
+	db, err := r.Get(NewIniLoader(fileName), "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := db.Config()
+	if cfg.SlowThreshold != time.Nanosecond || cfg.SlowLogRate != 1 || len(db.Hooks()) != 1 {
+		t.Fatal(cfg, db.Hooks())
+	}
+
+	logs := []string{}
+	hook := db.Hooks()[0].(*SlowQueryHook)
+	hook.Logf = func(format string, args ...interface{}) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}
+	if _, err := Exec(db, "UPDATE testing SET passwd=? WHERE id=?", Sensitive("secret"), 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Exec(db, "UPDATE testing SET name=?", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 {
+		t.Fatal(logs)
+	}
+	if !strings.Contains(logs[0], "slowlog_test.go:") || !strings.Contains(logs[0], "rows:1") || strings.Contains(logs[0], "secret") {
+		t.Fatal(logs[0])
+	}
+
+	// the suppressed is reported in the next window
+	now := time.Now()
+	hook.window = now.Add(-time.Second)
+	if suppressed, ok := hook.sample(now); !ok || suppressed != 1 {
+		t.Fatal(suppressed, ok)
+	}
+
+	// not slow
+	fast := NewSlowQueryHook(time.Hour, 0)
+	fast.Logf = hook.Logf
+	mdb, _ := newTestDB("mysql", func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		return nil, nil, nil
+	})
+	mdb.AddHook(fast)
+	if _, err := Exec(mdb, "UPDATE testing SET name=?", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 {
+		t.Fatal(logs)
+	}
+}
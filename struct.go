@@ -128,8 +128,7 @@ var refxM = reflectx.NewMapperTagFunc("db", func(in string) string {
 })
 
 // return is it a auto_increment field
-func travelStructField(f *reflectx.FieldInfo, v *reflect.Value, order *int, drvName *string, outputNames *[]byte, outputInputs *[]byte, outputVals *[]interface{}) *reflect.Value {
-	*order += 1
+func travelStructField(f *reflectx.FieldInfo, v *reflect.Value, outputFields *[]*reflectField) *reflect.Value {
 	switch v.Kind() {
 	case reflect.Invalid:
 		// nil value
@@ -168,12 +167,7 @@ func travelStructField(f *reflectx.FieldInfo, v *reflect.Value, order *int, drvN
 					continue
 				}
 				fieldVal := reflect.Indirect(*v).Field(i)
-				autoFiled := travelStructField(
-					child,
-					&fieldVal,
-					order, drvName,
-					outputNames, outputInputs, outputVals,
-				)
+				autoFiled := travelStructField(child, &fieldVal, outputFields)
 				if autoFiled != nil {
 					autoIncrement = autoFiled
 				}
@@ -191,9 +185,15 @@ func travelStructField(f *reflectx.FieldInfo, v *reflect.Value, order *int, drvN
 	}
 
 	//
-	// decode fileds
+	// collect fileds
 	//
 
+	*outputFields = append(*outputFields, &reflectField{
+		Name:    f.Name,
+		Value:   *v,
+		Options: f.Options,
+	})
+
 	_, ok := f.Options["autoincrement"]
 	if ok {
 		// ignore 'autoincrement' for insert data
@@ -205,30 +205,30 @@ func travelStructField(f *reflectx.FieldInfo, v *reflect.Value, order *int, drvN
 		return v
 	}
 
-	*outputVals = append(*outputVals, v.Interface())
-	switch {
-	case strings.Index(*drvName, "oracle") > -1, strings.Index(*drvName, "oci8") > -1:
-		*order += 1
-		*outputNames = append(*outputNames, []byte("\""+f.Name+"\",")...)
-		*outputInputs = append(*outputInputs, []byte(fmt.Sprintf(":%s,", f.Name))...)
-	case strings.Index(*drvName, "postgres") > -1:
-		*outputNames = append(*outputNames, []byte("\""+f.Name+"\",")...)
-		*outputInputs = append(*outputInputs, []byte(fmt.Sprintf(":%d,", *order))...)
-		*order += 1
-	case strings.Index(*drvName, "sqlserver") > -1, strings.Index(*drvName, "mssql") > -1:
-		*outputNames = append(*outputNames, []byte("["+f.Name+"],")...)
-		*outputInputs = append(*outputInputs, []byte(fmt.Sprintf("@p%d,", *order))...)
-		*order += 1
-	case strings.Index(*drvName, "mysql") > -1:
-		*order += 1
-		*outputNames = append(*outputNames, []byte("`"+f.Name+"`,")...)
-		*outputInputs = append(*outputInputs, []byte("?,")...)
-	default:
-		*outputNames = append(*outputNames, []byte("\""+f.Name+"\",")...)
-		*outputInputs = append(*outputInputs, []byte("?,")...)
+	return nil
+}
+
+// a column field of the struct
+type reflectField struct {
+	Name    string
+	Value   reflect.Value
+	Options map[string]string
+}
+
+// return true if one of the options is set.
+func (f *reflectField) HasOption(options ...string) bool {
+	for _, op := range options {
+		if _, ok := f.Options[op]; ok {
+			return true
+		}
 	}
+	return false
+}
 
-	return nil
+// return true when it is a key field for update or delete,
+// the field is marked with `pk` or it is a auto_increment field.
+func (f *reflectField) IsKey() bool {
+	return f.HasOption("pk", "autoincrement", "auto_increment")
 }
 
 type reflectInsertField struct {
@@ -236,9 +236,53 @@ type reflectInsertField struct {
 	Stmts  string
 	Values []interface{}
 
+	// all the column fields of struct in order, including the auto_increment field.
+	Fields []*reflectField
+
 	AutoIncrement *reflect.Value
 }
 
+// set the auto_increment field with the id returned by db.
+func (r *reflectInsertField) SetAutoIncrementId(id int64) {
+	if r.AutoIncrement == nil {
+		return
+	}
+	kind := r.AutoIncrement.Kind()
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		r.AutoIncrement.SetInt(id)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64: // Warnning: this maybe out of int64
+		r.AutoIncrement.SetUint(uint64(id))
+	default:
+		// unsupport other kind here
+		panic("unsupport auto increment kind: " + kind.String())
+	}
+}
+
+// split the fields to insert fields and the auto_increment field.
+func (r *reflectInsertField) AutoIncrementFields() (data []*reflectField, auto *reflectField) {
+	for _, f := range r.Fields {
+		if f.HasOption("autoincrement", "auto_increment") {
+			auto = f
+			continue
+		}
+		data = append(data, f)
+	}
+	return data, auto
+}
+
+// split the fields to data fields and key fields.
+func (r *reflectInsertField) KeyFields() (data []*reflectField, keys []*reflectField) {
+	for _, f := range r.Fields {
+		if f.IsKey() {
+			keys = append(keys, f)
+		} else {
+			data = append(data, f)
+		}
+	}
+	return data, keys
+}
+
 func (r *reflectInsertField) SetAutoIncrement(v reflect.Value) {
 	if r.AutoIncrement == nil {
 		return
@@ -246,6 +290,34 @@ func (r *reflectInsertField) SetAutoIncrement(v reflect.Value) {
 	r.AutoIncrement.Set(v)
 }
 
+// return the fields for insert and the conflict key fields for upsert,
+// the conflict key field flag like: `db:"id,pk"` or `db:"name,unique"`.
+// The auto_increment field is a conflict key when it is set and marked with `pk`,
+// or it is set and no other key field found, otherwise it is skipped for generating by db.
+func (r *reflectInsertField) ConflictFields() (data []*reflectField, keys []*reflectField) {
+	hasKey := false
+	for _, f := range r.Fields {
+		if !f.HasOption("autoincrement", "auto_increment") && f.HasOption("pk", "unique") {
+			hasKey = true
+		}
+	}
+	for _, f := range r.Fields {
+		if f.HasOption("autoincrement", "auto_increment") {
+			if f.Value.IsZero() || (hasKey && !f.HasOption("pk")) {
+				continue
+			}
+			data = append(data, f)
+			keys = append(keys, f)
+			continue
+		}
+		data = append(data, f)
+		if f.HasOption("pk", "unique") {
+			keys = append(keys, f)
+		}
+	}
+	return data, keys
+}
+
 func reflectInsertStruct(i interface{}, drvName string) (*reflectInsertField, error) {
 	v := reflect.ValueOf(i)
 	k := v.Kind()
@@ -258,13 +330,10 @@ func reflectInsertStruct(i interface{}, drvName string) (*reflectInsertField, er
 
 	tm := refxM.TypeMap(v.Type())
 
-	names := []byte{}
-	inputs := []byte{}
-	vals := []interface{}{}
+	fields := []*reflectField{}
 	var autoIncrement *reflect.Value
 
 	childrenLen := len(tm.Tree.Children)
-	order := 0
 	for i := 0; i < childrenLen; i++ {
 		field := tm.Tree.Children[i]
 		if field == nil {
@@ -273,19 +342,28 @@ func reflectInsertStruct(i interface{}, drvName string) (*reflectInsertField, er
 		}
 
 		fieldVal := v.Field(i)
-		autoField := travelStructField(field, &fieldVal, &order, &drvName, &names, &inputs, &vals)
+		autoField := travelStructField(field, &fieldVal, &fields)
 		if autoField != nil {
 			autoIncrement = autoField
 		}
 	}
 
-	if len(names) == 0 {
+	r := &reflectInsertField{
+		Fields:        fields,
+		AutoIncrement: autoIncrement,
+	}
+	data, _ := r.AutoIncrementFields()
+	if len(data) == 0 {
 		panic("No public field in struct")
 	}
-	return &reflectInsertField{
-		Names:         string(names[:len(names)-1]),
-		Stmts:         string(inputs[:len(inputs)-1]),
-		Values:        vals,
-		AutoIncrement: autoIncrement,
-	}, nil
+	d := GetDialect(drvName)
+	names := make([]string, len(data))
+	r.Values = make([]interface{}, len(data))
+	for i, f := range data {
+		names[i] = f.Name
+		r.Values[i] = f.Value.Interface()
+	}
+	r.Names = strings.Join(quoteIdents(d, "", names), ",")
+	r.Stmts = rebind(d, strings.Join(bindVars(len(data)), ","))
+	return r, nil
 }
@@ -1,9 +1,12 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -99,10 +102,241 @@ func TestReflect(t *testing.T) {
 	if refVal.Names != `"a","time","data","byte","dbdata","null_string","C","d","id","a","C","e"` {
 		t.Fatal(refVal.Names)
 	}
-	if refVal.Stmts != ":a,:time,:data,:byte,:dbdata,:null_string,:C,:d,:id,:a,:C,:e" {
+	if refVal.Stmts != ":1,:2,:3,:4,:5,:6,:7,:8,:9,:10,:11,:12" {
 		t.Fatal(refVal.Stmts)
 	}
 	if fmt.Sprintf("%+v", refVal.Values) != `[100 0001-01-01 00:00:00 +0000 UTC [97 98 99] 0  {String: Valid:false} testing d 1 101 testing1 e]` {
 		t.Fatal(refVal.Values)
 	}
 }
+
+type testResult struct {
+	lastId   int64
+	affected int64
+}
+
+func (r *testResult) LastInsertId() (int64, error) { return r.lastId, nil }
+func (r *testResult) RowsAffected() (int64, error) { return r.affected, nil }
+
+// record the sql that executed
+type testExecer struct {
+	query  string
+	args   []interface{}
+	lastId int64
+}
+
+func (e *testExecer) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return e.ExecContext(context.TODO(), query, args...)
+}
+func (e *testExecer) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	e.query = query
+	e.args = args
+	return &testResult{lastId: e.lastId, affected: 1}, nil
+}
+
+type ReflectTestStruct5 struct {
+	Uid  int64  `db:"uid,pk"`
+	Kind string `db:"kind, pk"`
+	Name string `db:"name"`
+}
+
+func TestUpdateStruct(t *testing.T) {
+	exec := &testExecer{}
+	s1 := &ReflectTestStruct1{Id: 1, A: 100}
+	if _, err := UpdateStruct(exec, s1, "testing", "mysql"); err != nil {
+		t.Fatal(err)
+	}
+	if exec.query != "UPDATE testing SET `a`=?,`time`=?,`data`=?,`byte`=?,`dbdata`=?,`null_string`=?,`C`=? WHERE `id`=?" {
+		t.Fatal(exec.query)
+	}
+	if len(exec.args) != 8 || exec.args[7] != int64(1) {
+		t.Fatalf("%+v", exec.args)
+	}
+
+	s5 := &ReflectTestStruct5{Uid: 1, Kind: "a", Name: "b"}
+	if _, err := UpdateStruct(exec, s5, "testing", "postgres"); err != nil {
+		t.Fatal(err)
+	}
+	if exec.query != `UPDATE testing SET "name"=$1 WHERE "uid"=$2 AND "kind"=$3` {
+		t.Fatal(exec.query)
+	}
+	if _, err := UpdateStruct(exec, s5, "testing", "oracle"); err != nil {
+		t.Fatal(err)
+	}
+	if exec.query != `UPDATE testing SET "name"=:1 WHERE "uid"=:2 AND "kind"=:3` {
+		t.Fatal(exec.query)
+	}
+
+	if _, err := UpdateStruct(exec, &ReflectTestStruct2{}, "testing", "mysql"); err == nil {
+		t.Fatal("expect no key field error")
+	}
+}
+
+func TestDeleteStruct(t *testing.T) {
+	exec := &testExecer{}
+	s5 := &ReflectTestStruct5{Uid: 1, Kind: "a", Name: "b"}
+	if _, err := DeleteStruct(exec, s5, "testing", "postgres"); err != nil {
+		t.Fatal(err)
+	}
+	if exec.query != `DELETE FROM testing WHERE "uid"=$1 AND "kind"=$2` {
+		t.Fatal(exec.query)
+	}
+	if fmt.Sprint(exec.args) != "[1 a]" {
+		t.Fatal(exec.args)
+	}
+	if _, err := DeleteStruct(exec, s5, "testing", "oracle"); err != nil {
+		t.Fatal(err)
+	}
+	if exec.query != `DELETE FROM testing WHERE "uid"=:1 AND "kind"=:2` {
+		t.Fatal(exec.query)
+	}
+
+	if _, err := DeleteByKey(exec, "testing", map[string]interface{}{"uid": 1, "kind": "a"}, "sqlserver"); err != nil {
+		t.Fatal(err)
+	}
+	if exec.query != `DELETE FROM testing WHERE [kind]=@p1 AND [uid]=@p2` {
+		t.Fatal(exec.query)
+	}
+	if fmt.Sprint(exec.args) != "[a 1]" {
+		t.Fatal(exec.args)
+	}
+
+	if _, err := DeleteStruct(exec, &ReflectTestStruct2{}, "testing", "mysql"); err == nil {
+		t.Fatal("expect no key field error")
+	}
+}
+
+type ReflectTestStruct6 struct {
+	Id   int64  `db:"id,auto_increment"`
+	Name string `db:"name,unique"`
+	Age  int    `db:"age"`
+}
+
+func TestUpsertStruct(t *testing.T) {
+	exec := &testExecer{}
+	s6 := &ReflectTestStruct6{Name: "a", Age: 1}
+	expects := map[string]string{
+		"mysql":     "INSERT INTO testing (`name`,`age`) VALUES (?,?) ON DUPLICATE KEY UPDATE `age`=VALUES(`age`);",
+		"postgres":  `INSERT INTO testing ("name","age") VALUES ($1,$2) ON CONFLICT ("name") DO UPDATE SET "age"=EXCLUDED."age";`,
+		"sqlite3":   `INSERT INTO testing ("name","age") VALUES (?,?) ON CONFLICT ("name") DO UPDATE SET "age"=EXCLUDED."age";`,
+		"sqlserver": `MERGE INTO testing AS t USING (VALUES (@p1,@p2)) AS s ([name],[age]) ON t.[name]=s.[name] WHEN MATCHED THEN UPDATE SET t.[age]=s.[age] WHEN NOT MATCHED THEN INSERT ([name],[age]) VALUES (s.[name],s.[age]);`,
+		"oracle":    `MERGE INTO testing t USING (SELECT :1 "name",:2 "age" FROM dual) s ON (t."name"=s."name") WHEN MATCHED THEN UPDATE SET t."age"=s."age" WHEN NOT MATCHED THEN INSERT ("name","age") VALUES (s."name",s."age")`,
+	}
+	for drvName, expect := range expects {
+		if _, err := UpsertStruct(exec, s6, "testing", drvName); err != nil {
+			t.Fatal(err)
+		}
+		if exec.query != expect {
+			t.Fatal(drvName, exec.query)
+		}
+		if fmt.Sprint(exec.args) != "[a 1]" {
+			t.Fatal(drvName, exec.args)
+		}
+	}
+
+	if _, err := UpsertStruct(exec, &ReflectTestStruct2{}, "testing", "mysql"); err == nil {
+		t.Fatal("expect no conflict key error")
+	}
+
+	// the auto_increment field is the conflict key when it is set.
+	type autoKeyStruct struct {
+		Id   int64  `db:"id,pk,auto_increment"`
+		Name string `db:"name"`
+	}
+	if _, err := UpsertStruct(exec, &autoKeyStruct{Id: 1, Name: "a"}, "testing", "postgres"); err != nil {
+		t.Fatal(err)
+	}
+	if exec.query != `INSERT INTO testing ("id","name") VALUES ($1,$2) ON CONFLICT ("id") DO UPDATE SET "name"=EXCLUDED."name";` {
+		t.Fatal(exec.query)
+	}
+	if _, err := UpsertStruct(exec, &ReflectTestStruct1{Id: 1}, "testing", "mysql"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(exec.query, "INSERT INTO testing (`id`,`a`,") {
+		t.Fatal(exec.query)
+	}
+	_, err := UpsertStruct(exec, &autoKeyStruct{Name: "a"}, "testing", "postgres")
+	if err == nil || !strings.Contains(err.Error(), "auto_increment") {
+		t.Fatal(err)
+	}
+}
+
+func TestInsertStructs(t *testing.T) {
+	exec := &testExecer{lastId: 10}
+	objs := []ReflectTestStruct6{{Name: "a", Age: 1}, {Name: "b", Age: 2}, {Name: "c", Age: 3}}
+	results, err := InsertStructs(exec, objs, "testing", "mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatal(len(results))
+	}
+	if exec.query != "INSERT INTO testing (`name`,`age`) VALUES (?,?),(?,?),(?,?);" {
+		t.Fatal(exec.query)
+	}
+	if fmt.Sprint(exec.args) != "[a 1 b 2 c 3]" {
+		t.Fatal(exec.args)
+	}
+	if objs[0].Id != 10 || objs[2].Id != 12 {
+		t.Fatalf("%+v", objs)
+	}
+
+	ptrs := []*ReflectTestStruct6{{Name: "a", Age: 1}, {Name: "b", Age: 2}}
+	if _, err := InsertStructs(exec, ptrs, "testing", "sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	if ptrs[0].Id != 9 || ptrs[1].Id != 10 {
+		t.Fatalf("%+v %+v", ptrs[0], ptrs[1])
+	}
+	db, drv := newTestDB("postgres", func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		return []string{"id"}, [][]driver.Value{{int64(5)}, {int64(6)}}, nil
+	})
+	if _, err := InsertStructs(db, ptrs, "testing"); err != nil {
+		t.Fatal(err)
+	}
+	if drv.LastQuery() != `INSERT INTO testing ("name","age") VALUES ($1,$2),($3,$4) RETURNING "id";` {
+		t.Fatal(drv.LastQuery())
+	}
+	if ptrs[0].Id != 5 || ptrs[1].Id != 6 {
+		t.Fatalf("%+v %+v", ptrs[0], ptrs[1])
+	}
+	// the order of the sqlserver OUTPUT rows is not guaranteed, so no back-fill for multi rows.
+	mssql, mssqlDrv := newTestDB("sqlserver", nil)
+	mptrs := []*ReflectTestStruct6{{Name: "a", Age: 1}, {Name: "b", Age: 2}}
+	if _, err := InsertStructs(mssql, mptrs, "testing"); err != nil {
+		t.Fatal(err)
+	}
+	if mssqlDrv.LastQuery() != `INSERT INTO testing ([name],[age]) VALUES (@p1,@p2),(@p3,@p4);` {
+		t.Fatal(mssqlDrv.LastQuery())
+	}
+	if mptrs[0].Id != 0 || mptrs[1].Id != 0 {
+		t.Fatalf("%+v %+v", mptrs[0], mptrs[1])
+	}
+
+	// chunk by the max params of sqlite3
+	many := make([]ReflectTestStruct6, 1000)
+	results, err = InsertStructs(exec, many, "testing", "sqlite3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatal(len(results))
+	}
+	if len(exec.args) != 2*(1000-499*2) {
+		t.Fatal(len(exec.args))
+	}
+
+	_, err = InsertStructs(exec, []*ReflectTestStruct6{{Name: "a"}, nil}, "testing", "mysql")
+	if err == nil || !strings.Contains(err.Error(), "Nil element") {
+		t.Fatal(err)
+	}
+	// the same count of columns with different names
+	type otherStruct struct {
+		A string `db:"a"`
+		B int    `db:"b"`
+	}
+	_, err = InsertStructs(exec, []interface{}{&ReflectTestStruct6{}, &otherStruct{}}, "testing", "mysql")
+	if err == nil || !strings.Contains(err.Error(), "Fields not match") {
+		t.Fatal(err)
+	}
+}
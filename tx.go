@@ -0,0 +1,199 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/gwaylib/errors"
+	"github.com/gwaylib/log"
+)
+
+// Inherit the sql.Tx, and keep the driver name of DB for the reflect functions.
+type Tx struct {
+	*sql.Tx
+	db  *DB
+	ctx context.Context
+
+	// the savepoint counter shared by the nested transactions.
+	savepoints *int
+	savepoint  string
+}
+
+// the context key of Tx for the db
+type txContextKey struct {
+	db *DB
+}
+
+func newTx(ctx context.Context, db *DB, tx *sql.Tx) *Tx {
+	t := &Tx{Tx: tx, db: db, savepoints: new(int)}
+	t.ctx = context.WithValue(ctx, txContextKey{db}, t)
+	return t
+}
+
+// Return the context which carries the tx,
+// the WithTx of DB called with this context will run in a savepoint of the tx.
+func (tx *Tx) Context() context.Context {
+	return tx.ctx
+}
+
+// Return the name of savepoint when it is a nested transaction, or empty.
+func (tx *Tx) Savepoint() string {
+	return tx.savepoint
+}
+
+func (tx *Tx) DriverName() string {
+	return tx.db.DriverName()
+}
+
+// Return the db which begin the tx.
+func (tx *Tx) DB() *DB {
+	return tx.db
+}
+
+// Return true if the error can be retried by a new transaction,
+// such as deadlock or serialization failure.
+type RetryClassifier func(err error) bool
+
+var (
+	retryLock        = sync.RWMutex{}
+	retryClassifiers = map[string]RetryClassifier{}
+)
+
+// Register a retry classifier for the driver name, it will replace the old one if exists.
+// The default classifier is used when the driver name not registered,
+// it matchs the errors by IsDeadlock or IsSerializationFailure with the driver name.
+func RegisterRetryClassifier(drvName string, fn RetryClassifier) {
+	retryLock.Lock()
+	defer retryLock.Unlock()
+	retryClassifiers[drvName] = fn
+}
+
+func getRetryClassifier(drvName string) RetryClassifier {
+	retryLock.RLock()
+	defer retryLock.RUnlock()
+	fn, ok := retryClassifiers[drvName]
+	if ok {
+		return fn
+	}
+	return func(err error) bool {
+		return defaultRetryClassifier(drvName, err)
+	}
+}
+
+func defaultRetryClassifier(drvName string, err error) bool {
+	return IsDeadlock(err, drvName) || IsSerializationFailure(err, drvName)
+}
+
+// Set the max times to retry the WithTx when the error is retryable by the RetryClassifier of driver,
+// default is 0 that not retry.
+func (db *DB) SetTxRetry(times int) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.txRetry = times
+}
+
+// Run fn in a transaction, commit when fn returns nil, rollback when fn returns an error or panics.
+// The panic will be re-panicked after rollback, and the error of fn is returned directly.
+// The transaction will be retried with a new one when the error is retryable and SetTxRetry is set,
+// so fn should be idempotent except the db operations.
+//
+// If ctx is from the Context of a Tx of this db, fn runs in a savepoint of that Tx instead,
+// and the opts is ignored. So the functions calling WithTx can be composed in one transaction.
+func (db *DB) WithTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *Tx) error) error {
+	if tx, ok := ctx.Value(txContextKey{db}).(*Tx); ok {
+		return tx.WithTx(ctx, fn)
+	}
+
+	db.mu.Lock()
+	retry := db.txRetry
+	db.mu.Unlock()
+	classifier := getRetryClassifier(db.driverName)
+
+	for i := 0; ; i++ {
+		err := db.withTx(ctx, opts, fn)
+		if err == nil {
+			return nil
+		}
+		if i >= retry || ctx.Err() != nil || !classifier(err) {
+			return err
+		}
+	}
+}
+
+func (db *DB) withTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *Tx) error) error {
+	run := startHooks(db, ctx, HOOK_OP_BEGIN, "", nil)
+	if run != nil {
+		ctx = run.ctx
+	}
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		run.end(HOOK_OP_ROLLBACK, -1, err)
+		return withCause(errors.As(err), err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			Rollback(tx)
+			run.end(HOOK_OP_ROLLBACK, -1, fmt.Errorf("panic: %v", p))
+			panic(p)
+		}
+	}()
+
+	if err := fn(newTx(ctx, db, tx)); err != nil {
+		Rollback(tx)
+		run.end(HOOK_OP_ROLLBACK, -1, err)
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		run.end(HOOK_OP_COMMIT, -1, err)
+		return withCause(errors.As(err), err)
+	}
+	run.end(HOOK_OP_COMMIT, -1, nil)
+	return nil
+}
+
+// Run fn in a savepoint of the tx, release the savepoint when fn returns nil,
+// rollback to the savepoint when fn returns an error or panics.
+// The panic will be re-panicked after rollback, and the error of fn is returned directly.
+// It uses 'SAVE TRANSACTION' for sqlserver.
+func (tx *Tx) WithTx(ctx context.Context, fn func(tx *Tx) error) error {
+	d := GetDialect(tx.DriverName())
+	*tx.savepoints++
+	nested := &Tx{
+		Tx:         tx.Tx,
+		db:         tx.db,
+		ctx:        tx.ctx,
+		savepoints: tx.savepoints,
+		savepoint:  fmt.Sprintf("sp_%d", *tx.savepoints),
+	}
+	nested.ctx = context.WithValue(tx.ctx, txContextKey{tx.db}, nested)
+
+	if _, err := execContext(tx, ctx, d.SavepointSql(nested.savepoint)); err != nil {
+		return withCause(errors.As(err, nested.savepoint), err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			nested.rollbackSavepoint(ctx, d)
+			panic(p)
+		}
+	}()
+
+	if err := fn(nested); err != nil {
+		nested.rollbackSavepoint(ctx, d)
+		return err
+	}
+	if releaseSql := d.ReleaseSavepointSql(nested.savepoint); len(releaseSql) > 0 {
+		if _, err := execContext(tx, ctx, releaseSql); err != nil {
+			return withCause(errors.As(err, nested.savepoint), err)
+		}
+	}
+	return nil
+}
+
+func (tx *Tx) rollbackSavepoint(ctx context.Context, d Dialect) {
+	// roll back error is a serious error
+	if _, err := execContext(tx, ctx, d.RollbackSavepointSql(tx.savepoint)); err != nil {
+		log.Error(errors.As(err, tx.savepoint))
+	}
+}
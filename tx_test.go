@@ -0,0 +1,160 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	stderrors "errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gwaylib/errors"
+)
+
+func TestWithTx(t *testing.T) {
+	db, drv := newTestDB("mysql", nil)
+	ctx := context.TODO()
+
+	if err := db.WithTx(ctx, nil, func(tx *Tx) error {
+		_, err := InsertStruct(tx, &ReflectTestStruct6{Name: "a"}, "testing")
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(drv.Queries()) != "[BEGIN INSERT INTO testing (`name`,`age`) VALUES (?,?); COMMIT]" {
+		t.Fatal(drv.Queries())
+	}
+
+	errTest := errors.New("testing")
+	if err := db.WithTx(ctx, nil, func(tx *Tx) error {
+		return errTest
+	}); err != errTest {
+		t.Fatal(err)
+	}
+	if drv.LastQuery() != "ROLLBACK" {
+		t.Fatal(drv.LastQuery())
+	}
+
+	func() {
+		defer func() {
+			if p := recover(); p != "testing" {
+				t.Fatal(p)
+			}
+			if drv.LastQuery() != "ROLLBACK" {
+				t.Fatal(drv.LastQuery())
+			}
+		}()
+		db.WithTx(ctx, nil, func(tx *Tx) error {
+			panic("testing")
+		})
+	}()
+}
+
+func TestWithTxRetry(t *testing.T) {
+	failed := 0
+	db, drv := newTestDB("mysql", func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		if strings.HasPrefix(query, "UPDATE") && failed < 2 {
+			failed++
+			return nil, nil, fmt.Errorf("Error 1213: Deadlock found when trying to get lock")
+		}
+		return nil, nil, nil
+	})
+	fn := func(tx *Tx) error {
+		_, err := tx.Exec("UPDATE testing SET a=1")
+		return err
+	}
+	if err := db.WithTx(context.TODO(), nil, fn); err == nil {
+		t.Fatal("expect deadlock error")
+	}
+
+	db.SetTxRetry(3)
+	if err := db.WithTx(context.TODO(), nil, fn); err != nil {
+		t.Fatal(err)
+	}
+	if failed != 2 || drv.LastQuery() != "COMMIT" {
+		t.Fatal(failed, drv.Queries())
+	}
+}
+
+func TestWithTxSavepoint(t *testing.T) {
+	db, drv := newTestDB("sqlserver", nil)
+	errTest := errors.New("testing")
+
+	// a library function which begins a transaction
+	createUser := func(ctx context.Context, fail bool) error {
+		return db.WithTx(ctx, nil, func(tx *Tx) error {
+			if _, err := tx.Exec("INSERT"); err != nil {
+				return err
+			}
+			if fail {
+				return errTest
+			}
+			return nil
+		})
+	}
+	if err := db.WithTx(context.TODO(), nil, func(tx *Tx) error {
+		if err := createUser(tx.Context(), false); err != nil {
+			return err
+		}
+		if err := createUser(tx.Context(), true); err != errTest {
+			t.Fatal(err)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	expect := "[BEGIN SAVE TRANSACTION sp_1 INSERT SAVE TRANSACTION sp_2 INSERT ROLLBACK TRANSACTION sp_2 COMMIT]"
+	if fmt.Sprint(drv.Queries()) != expect {
+		t.Fatal(drv.Queries())
+	}
+
+	db, drv = newTestDB("postgres", nil)
+	if err := db.WithTx(context.TODO(), nil, func(tx *Tx) error {
+		return tx.WithTx(tx.Context(), func(tx *Tx) error {
+			return db.WithTx(tx.Context(), nil, func(tx *Tx) error {
+				return nil
+			})
+		})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	expect = "[BEGIN SAVEPOINT sp_1 SAVEPOINT sp_2 RELEASE SAVEPOINT sp_2 RELEASE SAVEPOINT sp_1 COMMIT]"
+	if fmt.Sprint(drv.Queries()) != expect {
+		t.Fatal(drv.Queries())
+	}
+}
+
+func TestExecMultiTxResults(t *testing.T) {
+	db, drv := newTestDB("mysql", func(query string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		if strings.Contains(query, "version=2") {
+			// no rows affected
+			return nil, [][]driver.Value{}, nil
+		}
+		return nil, nil, nil
+	})
+	mTx := []*MultiTx{
+		NewMultiTx("UPDATE a SET name=? WHERE version=1", "a").ExpectRows(1),
+		NewMultiTx("UPDATE b SET name=? WHERE version=2", "b").ExpectRows(1),
+	}
+	var results []sql.Result
+	err := db.WithTx(context.TODO(), nil, func(tx *Tx) error {
+		var err error
+		results, err = ExecMultiTxResults(tx, mTx)
+		return err
+	})
+	mErr, ok := err.(*MultiTxError)
+	if !ok {
+		t.Fatal(err)
+	}
+	if mErr.Index != 1 || mErr.Query != mTx[1].Query || !ErrRowsAffected.Equal(mErr.Err) {
+		t.Fatal(mErr)
+	}
+	var rErr *RowsAffectedError
+	if !stderrors.Is(err, ErrRowsAffected) || !stderrors.As(err, &rErr) || rErr.Expect != 1 || rErr.Actual != 0 {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || drv.LastQuery() != "ROLLBACK" {
+		t.Fatal(results, drv.Queries())
+	}
+}
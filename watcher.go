@@ -0,0 +1,220 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/gwaylib/errors"
+)
+
+// Watch the config file of a loader and the secret files of the configs by polling,
+// and reload the cached db when its section changed.
+// The changed section will be opened with a new db which inherits the hooks and tx retry of the old one,
+// and swapped into the cache, then the old db will be closed after its in-use connections returned or the drain time.
+// So the caller should get the db by GetCache when using it, and not hold the *DB,
+// the held one will return the error of "database is closed" after reloading.
+type Watcher struct {
+	registry *Registry
+	loader   ConfigLoader
+	interval time.Duration
+	drain    time.Duration
+	onReload func(sectionName string, oldDB, newDB *DB, err error)
+
+	mu    sync.Mutex
+	files map[string]*fileState
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// Make a watcher for the file of loader, the loader.Source() should be the file name.
+// interval is the polling interval, drain is the max time to wait the in-use connections before closing the old db.
+func NewWatcher(loader ConfigLoader, interval, drain time.Duration) *Watcher {
+	return defaultRegistry.NewWatcher(loader, interval, drain)
+}
+
+// Make a watcher for the dbs in the registry, see NewWatcher.
+func (r *Registry) NewWatcher(loader ConfigLoader, interval, drain time.Duration) *Watcher {
+	return &Watcher{
+		registry: r,
+		loader:   loader,
+		interval: interval,
+		drain:    drain,
+		files:    map[string]*fileState{},
+		stop:     make(chan struct{}),
+	}
+}
+
+// Set a hook to observe the reload, err is not nil when reload failed, and the old db is kept.
+func (w *Watcher) OnReload(fn func(sectionName string, oldDB, newDB *DB, err error)) *Watcher {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.onReload = fn
+	return w
+}
+
+// Start the polling in background, it returns an error when the interval is not positive.
+func (w *Watcher) Start() error {
+	if w.interval <= 0 {
+		return errors.New("error watcher interval").As(w.interval)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.changed(); err != nil {
+		return errors.As(err)
+	}
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.Check()
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop the polling.
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+}
+
+// Check the file once, and reload the changed sections in the cache.
+func (w *Watcher) Check() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	changed, err := w.changed()
+	if err != nil {
+		w.notify("", nil, nil, errors.As(err))
+		return
+	}
+	if !changed {
+		return
+	}
+
+	for key, db := range w.registry.snapshot() {
+		oldCfg := db.Config()
+		if key.Source != w.loader.Source() || oldCfg == nil {
+			continue
+		}
+		newCfg, err := w.loader.Load(oldCfg.Section)
+		if err != nil {
+			w.notify(oldCfg.Section, db, nil, errors.As(err))
+			continue
+		}
+		if reflect.DeepEqual(newCfg, oldCfg) {
+			continue
+		}
+		newDB, err := openConfig(newCfg)
+		if err != nil {
+			w.notify(oldCfg.Section, db, nil, errors.As(err, newCfg.Source, newCfg.Section))
+			continue
+		}
+		newDB.inherit(db)
+		if !w.registry.swap(key, db, newDB) {
+			// the old one has been removed from the cache.
+			Close(newDB)
+			continue
+		}
+		// record the secret files referenced newly, so the rotating before the next poll is found.
+		w.recordFiles(newCfg.SecretFiles)
+		go func(db *DB) {
+			ctx, cancel := context.WithTimeout(context.Background(), w.drain)
+			defer cancel()
+			drainDB(ctx, db)
+			Close(db)
+		}(db)
+		w.notify(oldCfg.Section, db, newDB, nil)
+	}
+}
+
+func (w *Watcher) notify(sectionName string, oldDB, newDB *DB, err error) {
+	if w.onReload != nil {
+		w.onReload(sectionName, oldDB, newDB, err)
+	}
+}
+
+// the state of a watched file.
+type fileState struct {
+	modTime time.Time
+	size    int64
+	hash    [sha256.Size]byte
+}
+
+// return the files to watch, they are the file of loader and the secret files of the cached configs.
+func (w *Watcher) watchFiles() []string {
+	files := []string{w.loader.Source()}
+	exists := map[string]bool{w.loader.Source(): true}
+	for key, db := range w.registry.snapshot() {
+		cfg := db.Config()
+		if key.Source != w.loader.Source() || cfg == nil {
+			continue
+		}
+		for _, fileName := range cfg.SecretFiles {
+			if !exists[fileName] {
+				exists[fileName] = true
+				files = append(files, fileName)
+			}
+		}
+	}
+	return files
+}
+
+// return true if one of the watched files changed since last call,
+// the first call of a file is only recording the state.
+func (w *Watcher) changed() (bool, error) {
+	changed := false
+	for _, fileName := range w.watchFiles() {
+		c, err := w.fileChanged(fileName)
+		if err != nil {
+			return false, errors.As(err)
+		}
+		changed = changed || c
+	}
+	return changed, nil
+}
+
+// record the state of the files which are not watched yet.
+func (w *Watcher) recordFiles(files []string) {
+	for _, fileName := range files {
+		if _, ok := w.files[fileName]; !ok {
+			// the error is returned by the next poll.
+			w.fileChanged(fileName)
+		}
+	}
+}
+
+// return true if the file changed since last call, the first call is only recording the state.
+func (w *Watcher) fileChanged(fileName string) (bool, error) {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return false, errors.As(err, fileName)
+	}
+	state, ok := w.files[fileName]
+	if ok && info.ModTime().Equal(state.modTime) && info.Size() == state.size {
+		return false, nil
+	}
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return false, errors.As(err, fileName)
+	}
+	hash := sha256.Sum256(data)
+	if !ok {
+		w.files[fileName] = &fileState{info.ModTime(), info.Size(), hash}
+		return false, nil
+	}
+	changed := hash != state.hash
+	state.modTime, state.size, state.hash = info.ModTime(), info.Size(), hash
+	return changed, nil
+}